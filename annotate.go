@@ -0,0 +1,69 @@
+// Package zerr provides scoped annotation of returned errors.
+package zerr
+
+import (
+	"runtime"
+	"strings"
+)
+
+// Annotate attaches alternating key-value pairs as metadata to the error
+// pointed to by errp if it is not nil, so that metadata shared by every return
+// statement of a function is declared once:
+//
+//	func CreateUser(id int) (err error) {
+//		defer zerr.Annotate(&err, "op", "CreateUser", "user_id", id)
+//		...
+//	}
+//
+// The pairs are evaluated when the defer statement executes, so non-constant
+// values are boxed up front, which costs an allocation even on the happy path;
+// use AnnotateLazy in hot paths.
+func Annotate(errp *error, keyvals ...any) {
+	if *errp == nil {
+		return
+	}
+	*errp = annotate(*errp, "", keyvals)
+}
+
+// AnnotateLazy is like Annotate but only calls keyvals to build the pairs if
+// the error is not nil, so that the happy path does not allocate:
+//
+//	defer zerr.AnnotateLazy(&err, func() []any { return []any{"user_id", id} })
+func AnnotateLazy(errp *error, keyvals func() []any) {
+	if *errp == nil {
+		return
+	}
+	*errp = annotate(*errp, "", keyvals())
+}
+
+// AnnotateFunc is like Annotate but also wraps the error with the name of the
+// function that deferred it, such as "CreateUser" or "(*Store).Get".
+func AnnotateFunc(errp *error, keyvals ...any) {
+	if *errp == nil {
+		return
+	}
+
+	var pc [1]uintptr
+	runtime.Callers(2, pc[:]) // Skip runtime.Callers and AnnotateFunc
+	*errp = annotate(*errp, shortFuncName(funcName(pc[0])), keyvals)
+}
+
+// annotate wraps err with message, if any, and attaches the key-value pairs.
+func annotate(err error, message string, keyvals []any) error {
+	zerr, ok := err.(*Error)
+	if !ok || message != "" {
+		zerr = &Error{message: message, cause: err}
+	}
+	return zerr.withKeyvals(keyvals)
+}
+
+// shortFuncName strips the package path from a fully qualified function name.
+func shortFuncName(name string) string {
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
@@ -0,0 +1,67 @@
+// Package zerr provides check-and-handle control flow helpers.
+package zerr
+
+import (
+	"runtime"
+)
+
+// checkPanic is the sentinel panic value raised by Check and Must1.
+type checkPanic struct {
+	err error
+	pc  [1]uintptr
+}
+
+// Check panics with an internal sentinel carrying err if err is not nil.
+// The panic should be recovered by a deferred Handle in the same or a calling
+// function; Defer, Recover, Try and Group also turn it back into err, wrapped
+// with the location of the Check, rather than into a panic error:
+//
+//	func parse(path string) (cfg *Config, err error) {
+//		defer zerr.Handle(&err, "parsing config")
+//		data := zerr.Must1(os.ReadFile(path))
+//		zerr.Check(json.Unmarshal(data, &cfg))
+//		return cfg, nil
+//	}
+func Check(err error) {
+	if err != nil {
+		raise(err)
+	}
+}
+
+// Must1 returns v if err is nil and panics like Check otherwise.
+func Must1[T any](v T, err error) T {
+	if err != nil {
+		raise(err)
+	}
+	return v
+}
+
+// raise panics with a sentinel carrying err and the location of the caller
+// of Check or Must1.
+func raise(err error) {
+	p := &checkPanic{err: err}
+	runtime.Callers(3, p.pc[:]) // Skip runtime.Callers, raise, and Check or Must1
+	panic(p)
+}
+
+// Handle recovers a panic raised by Check or Must1 and assigns its error,
+// wrapped with message, to the error pointed to by errp. The wrapping layer
+// records the location of the failing Check as a single-frame stack trace.
+// Any other panic is propagated. Handle must be called directly by defer.
+func Handle(errp *error, message string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	p, ok := r.(*checkPanic)
+	if !ok {
+		panic(r)
+	}
+
+	*errp = &Error{
+		message: message,
+		cause:   p.err,
+		stack:   internStack(p.pc[:]),
+	}
+}
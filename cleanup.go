@@ -0,0 +1,59 @@
+// Package zerr provides helpers that merge deferred cleanup errors into results.
+package zerr
+
+import (
+	"fmt"
+	"io"
+)
+
+// Close closes closer and merges a close error, wrapped with message, into
+// the error pointed to by errp without overwriting an error already there.
+// The failing resource is recorded as "resource" metadata, using its Name
+// method if it has one (such as *os.File) and its type otherwise.
+//
+//	func write(path string) (err error) {
+//		f, err := os.Create(path)
+//		if err != nil {
+//			return err
+//		}
+//		defer zerr.Close(&err, f, "closing output")
+//		...
+//	}
+func Close(errp *error, closer io.Closer, message string) {
+	closeErr := closer.Close()
+	if closeErr == nil {
+		return
+	}
+
+	err := &Error{
+		message: message,
+		cause:   closeErr,
+	}
+	joinInto(errp, err.With("resource", resourceName(closer)))
+}
+
+// Cleanup calls fn and merges its error into the error pointed to by errp
+// without overwriting an error already there.
+func Cleanup(errp *error, fn func() error) {
+	joinInto(errp, fn())
+}
+
+// joinInto assigns err to *errp, joining it with an error already there.
+func joinInto(errp *error, err error) {
+	if err == nil {
+		return
+	}
+	if *errp == nil {
+		*errp = err
+		return
+	}
+	*errp = Join(*errp, err)
+}
+
+// resourceName describes the resource behind closer.
+func resourceName(closer io.Closer) string {
+	if named, ok := closer.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", closer)
+}
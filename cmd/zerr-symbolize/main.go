@@ -0,0 +1,292 @@
+// Command zerr-symbolize resolves stacks encoded by zerr.EncodeStack against
+// the binary that produced them.
+//
+// Usage:
+//
+//	zerr-symbolize -binary path/to/binary [file]
+//
+// Encoded stacks are read one per line from file, or from standard input when
+// no file is given. Lines that are not encoded stacks are ignored. Frames are
+// printed in the style of a Go traceback, with inlined frames marked by
+// "(...)". Inlined frames are resolved using the DWARF debug information of
+// the binary when available, falling back to the Go line table otherwise.
+package main
+
+import (
+	"bufio"
+	"debug/dwarf"
+	"debug/elf"
+	"debug/gosym"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.trai.ch/zerr"
+	"go.trai.ch/zerr/internal/buildid"
+)
+
+func main() {
+	binary := flag.String("binary", "", "path to the binary that produced the stacks")
+	flag.Parse()
+
+	if *binary == "" || flag.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "usage: zerr-symbolize -binary path/to/binary [file]")
+		os.Exit(2)
+	}
+
+	in := io.Reader(os.Stdin)
+	if flag.NArg() == 1 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zerr-symbolize:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	if err := run(os.Stdout, os.Stderr, *binary, in); err != nil {
+		fmt.Fprintln(os.Stderr, "zerr-symbolize:", err)
+		os.Exit(1)
+	}
+}
+
+// run symbolizes every encoded stack read from in against the binary at path.
+// Warnings, such as build ID mismatches, are written to warn.
+func run(w, warn io.Writer, path string, in io.Reader) error {
+	s, err := open(path)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	bw := bufio.NewWriter(w)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 1<<20)
+
+	first := true
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "zerr1 ") {
+			continue
+		}
+		stack, err := zerr.DecodeStack(line)
+		if err != nil {
+			fmt.Fprintln(warn, "zerr-symbolize:", err)
+			continue
+		}
+
+		if stack.BuildID != "" && s.buildID != "" && stack.BuildID != s.buildID {
+			fmt.Fprintf(warn, "zerr-symbolize: build ID mismatch: stack has %s, binary has %s\n", stack.BuildID, s.buildID)
+		}
+
+		if !first {
+			bw.WriteByte('\n')
+		}
+		first = false
+		for _, f := range s.frames(stack) {
+			args := "()"
+			if f.inlined {
+				args = "(...)"
+			}
+			fmt.Fprintf(bw, "%s%s\n\t%s:%d\n", f.function, args, f.file, f.line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// frame is a resolved stack frame.
+type frame struct {
+	function string
+	file     string
+	line     int
+	inlined  bool
+}
+
+// symbolizer resolves program counters against an ELF binary.
+type symbolizer struct {
+	file    *elf.File
+	buildID string
+	table   *gosym.Table
+	dwarf   *dwarf.Data
+}
+
+// open loads the symbol tables of the ELF binary at path.
+func open(path string) (*symbolizer, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pclntab := f.Section(".gopclntab")
+	text := f.Section(".text")
+	if pclntab == nil || text == nil {
+		f.Close()
+		return nil, errors.New("binary has no Go line table")
+	}
+	data, err := pclntab.Data()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(data, text.Addr))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	s := &symbolizer{file: f, table: table}
+	s.buildID, _ = buildid.Read(f)
+	// Stripped binaries have no DWARF, inlined frames are then attributed to
+	// the function they were inlined into
+	s.dwarf, _ = f.DWARF()
+	return s, nil
+}
+
+// close releases the binary.
+func (s *symbolizer) close() {
+	s.file.Close()
+}
+
+// frames resolves the program counters of stack. Each program counter yields
+// exactly one frame since zerr captures inlined calls as separate entries.
+func (s *symbolizer) frames(stack *zerr.EncodedStack) []frame {
+	bias := s.bias(stack)
+
+	frames := make([]frame, 0, len(stack.PCs))
+	for _, pc := range stack.PCs {
+		// Return addresses point after the call instruction
+		addr := uint64(pc-bias) - 1
+		if f, ok := s.dwarfFrame(addr); ok {
+			frames = append(frames, f)
+			continue
+		}
+		file, line, fn := s.table.PCToLine(addr)
+		if fn == nil {
+			frames = append(frames, frame{function: fmt.Sprintf("?? %#x", pc), file: "??"})
+			continue
+		}
+		frames = append(frames, frame{function: fn.Name, file: file, line: line})
+	}
+	return frames
+}
+
+// bias returns the difference between runtime and link-time addresses, which
+// is non-zero for position independent executables.
+func (s *symbolizer) bias(stack *zerr.EncodedStack) uintptr {
+	if stack.AnchorFunc == "" {
+		return 0
+	}
+	fn := s.table.LookupFunc(stack.AnchorFunc)
+	if fn == nil {
+		return 0
+	}
+	return stack.Anchor - uintptr(fn.Entry)
+}
+
+// dwarfFrame resolves addr to the innermost, possibly inlined, function
+// containing it using the DWARF debug information.
+func (s *symbolizer) dwarfFrame(addr uint64) (frame, bool) {
+	if s.dwarf == nil {
+		return frame{}, false
+	}
+
+	r := s.dwarf.Reader()
+	cu, err := r.SeekPC(addr)
+	if err != nil {
+		return frame{}, false
+	}
+	lr, err := s.dwarf.LineReader(cu)
+	if err != nil || lr == nil {
+		return frame{}, false
+	}
+	var le dwarf.LineEntry
+	if err := lr.SeekPC(addr, &le); err != nil {
+		return frame{}, false
+	}
+
+	// Descend through the entries containing addr, remembering the innermost
+	// function; a null entry ends the children of the last containing entry
+	var fn *dwarf.Entry
+	for {
+		e, err := r.Next()
+		if err != nil || e == nil || e.Tag == 0 {
+			break
+		}
+		if !s.contains(e, addr) {
+			if e.Children {
+				r.SkipChildren()
+			}
+			continue
+		}
+		switch e.Tag {
+		case dwarf.TagSubprogram, dwarf.TagInlinedSubroutine:
+			fn = e
+		}
+		if !e.Children {
+			break
+		}
+	}
+	if fn == nil {
+		return frame{}, false
+	}
+
+	name := s.name(fn)
+	if name == "" {
+		return frame{}, false
+	}
+	f := frame{
+		function: name,
+		line:     le.Line,
+		inlined:  fn.Tag == dwarf.TagInlinedSubroutine,
+	}
+	if le.File != nil {
+		f.file = le.File.Name
+	}
+	return f, true
+}
+
+// contains reports whether the address ranges of e contain addr.
+func (s *symbolizer) contains(e *dwarf.Entry, addr uint64) bool {
+	switch e.Tag {
+	case dwarf.TagSubprogram, dwarf.TagInlinedSubroutine, dwarf.TagLexDwarfBlock:
+	default:
+		return false
+	}
+	ranges, err := s.dwarf.Ranges(e)
+	if err != nil {
+		return false
+	}
+	for _, r := range ranges {
+		if r[0] <= addr && addr < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// name returns the function name of e, following its abstract origin for
+// inlined and out-of-line instances of inlinable functions.
+func (s *symbolizer) name(e *dwarf.Entry) string {
+	if name, ok := e.Val(dwarf.AttrName).(string); ok {
+		return name
+	}
+	off, ok := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+	if !ok {
+		return ""
+	}
+	r := s.dwarf.Reader()
+	r.Seek(off)
+	origin, err := r.Next()
+	if err != nil || origin == nil {
+		return ""
+	}
+	name, _ := origin.Val(dwarf.AttrName).(string)
+	return name
+}
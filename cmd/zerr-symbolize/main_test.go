@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"go.trai.ch/zerr"
+)
+
+func TestSymbolizeSelf(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip("executable path unavailable:", err)
+	}
+	s, err := open(exe)
+	if err != nil {
+		t.Skip("binary cannot be symbolized:", err)
+	}
+	defer s.close()
+
+	stack, err := zerr.DecodeStack(zerr.EncodeStack(zerr.WithStack(errors.New("failure"))))
+	if err != nil {
+		t.Fatalf("Expected encoded stack to decode, got %v", err)
+	}
+
+	// go test strips DWARF from the test binary, so only positions are
+	// reliable for inlined frames
+	got := s.frames(stack)
+	frames := runtime.CallersFrames(stack.PCs)
+	for i := 0; ; i++ {
+		want, more := frames.Next()
+		if i >= len(got) {
+			t.Fatalf("Expected frame %s, got none", want.Function)
+		}
+		if got[i].file != want.File || got[i].line != want.Line {
+			t.Errorf("Expected frame %d at %s:%d, got %s:%d", i, want.File, want.Line, got[i].file, got[i].line)
+		}
+		if !more {
+			break
+		}
+	}
+	if !strings.HasSuffix(got[0].function, ".TestSymbolizeSelf") {
+		t.Errorf("Expected first frame to be TestSymbolizeSelf, got %s", got[0].function)
+	}
+}
+
+func TestSymbolizeBinary(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a binary")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command unavailable")
+	}
+
+	for _, mode := range []string{"exe", "pie"} {
+		t.Run(mode, func(t *testing.T) {
+			exe := filepath.Join(t.TempDir(), "crash")
+			build := exec.Command(gobin, "build", "-buildmode="+mode, "-o", exe, "./testdata/crash")
+			if out, err := build.CombinedOutput(); err != nil {
+				t.Skipf("cannot build in %s mode: %v\n%s", mode, err, out)
+			}
+
+			out, err := exec.Command(exe).Output()
+			if err != nil {
+				t.Fatalf("Expected crash to run, got %v", err)
+			}
+			// The program prints the encoded stack followed by the frames
+			// resolved by the runtime
+			encoded, want, _ := strings.Cut(string(out), "\n")
+
+			var got, warn strings.Builder
+			input := "unrelated log line\n" + encoded + "\n"
+			if err := run(&got, &warn, exe, strings.NewReader(input)); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if warn.Len() != 0 {
+				t.Errorf("Expected no warnings, got %q", warn.String())
+			}
+			if got.String() != want {
+				t.Errorf("Expected frames\n%s\ngot\n%s", want, got.String())
+			}
+			if !strings.HasPrefix(got.String(), "main.fail(...)\n") {
+				t.Errorf("Expected inlined main.fail frame first, got %q", got.String())
+			}
+		})
+	}
+}
+
+func TestBuildIDMismatch(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip("executable path unavailable:", err)
+	}
+	if _, err := open(exe); err != nil {
+		t.Skip("binary cannot be symbolized:", err)
+	}
+
+	var out, warn strings.Builder
+	input := "zerr1 buildid=other pcs=1\n"
+	if err := run(&out, &warn, exe, strings.NewReader(input)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(warn.String(), "build ID mismatch") {
+		t.Errorf("Expected build ID mismatch warning, got %q", warn.String())
+	}
+}
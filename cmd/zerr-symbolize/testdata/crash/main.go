@@ -0,0 +1,38 @@
+// Command crash prints an encoded stack followed by the frames the runtime
+// resolves for it, for testing zerr-symbolize.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+
+	"go.trai.ch/zerr"
+)
+
+// fail is small enough to be inlined into main.
+func fail() error {
+	return zerr.WithStack(errors.New("failure"))
+}
+
+func main() {
+	encoded := zerr.EncodeStack(fail())
+	fmt.Println(encoded)
+
+	stack, err := zerr.DecodeStack(encoded)
+	if err != nil {
+		panic(err)
+	}
+	frames := runtime.CallersFrames(stack.PCs)
+	for {
+		f, more := frames.Next()
+		args := "()"
+		if f.Func == nil {
+			args = "(...)"
+		}
+		fmt.Printf("%s%s\n\t%s:%d\n", f.Function, args, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+}
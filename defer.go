@@ -2,10 +2,26 @@
 package zerr
 
 import (
+	"errors"
 	"fmt"
+	"runtime"
 )
 
+const (
+	// CodePanic is the code of errors converted from recovered panics.
+	CodePanic = "panic"
+	// CodeBug is the code of errors converted from recovered runtime errors,
+	// such as nil pointer dereferences or out of range indexes.
+	CodeBug = "bug"
+)
+
+// panicInfo holds the original value of a recovered panic.
+type panicInfo struct {
+	value any
+}
+
 // Defer recovers from panics in goroutines and converts them to errors.
+// The stack trace of the error starts at the line that panicked.
 func Defer(handler func(error)) {
 	if r := recover(); r != nil {
 		err := convertPanicToError(r)
@@ -13,27 +29,81 @@ func Defer(handler func(error)) {
 	}
 }
 
+// Recover recovers from a panic and assigns it as an error to the named error
+// return pointed to by errp. An error already assigned to *errp is joined with
+// the panic rather than replaced. Optional alternating key-value pairs are
+// attached to the panic error as metadata. Recover must be called directly by
+// defer:
+//
+//	func process() (err error) {
+//		defer zerr.Recover(&err, "op", "process")
+//		...
+//	}
+//
+// The stack trace of the error starts at the line that panicked.
+func Recover(errp *error, keyvals ...any) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	joinInto(errp, newPanicError(r, panicStack(1)).withKeyvals(keyvals))
+}
+
+// PanicValue returns the original value of the recovered panic that err was
+// converted from, searching the whole tree including the errors combined by
+// Join.
+func PanicValue(err error) (any, bool) {
+	for e := range layers(err) {
+		if zerr, ok := e.(*Error); ok && zerr.extension().panic != nil {
+			return zerr.extension().panic.value, true
+		}
+	}
+	return nil, false
+}
+
 // convertPanicToError converts a panic value to a zerr Error.
 func convertPanicToError(r any) *Error {
+	// Outside of a panic, skip Defer, recover, and this function
+	return newPanicError(r, panicStack(3))
+}
+
+// newPanicError converts a panic value to a zerr Error with the given stack.
+// Runtime errors are marked with CodeBug, other panics with CodePanic. Errors,
+// including *Error values, are wrapped so that they keep their own layers.
+// The sentinel of a Check or Must1 without a Handle is not a panic of the
+// program: its error is returned wrapped with the location of the Check.
+func newPanicError(r any, stack *stackCacheEntry) *Error {
+	if p, ok := r.(*checkPanic); ok {
+		return &Error{cause: p.err, stack: internStack(p.pc[:])}
+	}
+
+	info := &panicInfo{value: r}
 	switch v := r.(type) {
-	case *Error:
-		return v
 	case error:
+		code := CodePanic
+		var runtimeErr runtime.Error
+		if errors.As(v, &runtimeErr) {
+			code = CodeBug
+		}
 		return &Error{
 			message: "panic recovered",
 			cause:   v,
-			stack:   getOrCreateStack(3), // Skip Defer, recover, and this function
+			stack:   stack,
+			ext:     &errorExt{code: code, panic: info},
 		}
 	case string:
 		return &Error{
 			message: v,
-			stack:   getOrCreateStack(3),
+			stack:   stack,
+			ext:     &errorExt{code: CodePanic, panic: info},
 		}
 	default:
 		return &Error{
 			message: "panic recovered",
 			cause:   &Error{message: fmt.Sprintf("%v", v)},
-			stack:   getOrCreateStack(3),
+			stack:   stack,
+			ext:     &errorExt{code: CodePanic, panic: info},
 		}
 	}
 }
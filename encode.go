@@ -0,0 +1,174 @@
+// Package zerr provides raw stack trace encoding for offline symbolization.
+package zerr
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.trai.ch/zerr/internal/buildid"
+)
+
+// encodedStackPrefix identifies version 1 of the encoded stack format.
+const encodedStackPrefix = "zerr1"
+
+// EncodedStack is a stack trace in raw program counter form, together with the
+// build metadata needed to symbolize it later against the same binary, for
+// example with the zerr-symbolize command.
+type EncodedStack struct {
+	// BuildID is the Go build ID of the executable, if known.
+	BuildID string
+	// GNUBuildID is the hex-encoded GNU build ID of the executable, if known.
+	GNUBuildID string
+	// Module is the path of the main module.
+	Module string
+	// Version is the version of the main module.
+	Version string
+	// AnchorFunc and Anchor are the name and runtime entry address of a known
+	// function, used to compute the load address of position independent
+	// executables.
+	AnchorFunc string
+	Anchor     uintptr
+	// PCs are the raw return program counters of the stack, innermost first.
+	PCs []uintptr
+}
+
+// buildMetadata holds the build metadata of the running executable.
+type buildMetadata struct {
+	buildID    string
+	gnuBuildID string
+	module     string
+	version    string
+	anchorFunc string
+	anchor     uintptr
+}
+
+// currentBuild returns the build metadata of the running executable, reading
+// it on first use.
+var currentBuild = sync.OnceValue(func() buildMetadata {
+	var m buildMetadata
+	if info, ok := debug.ReadBuildInfo(); ok {
+		m.module = info.Main.Path
+		m.version = info.Main.Version
+	}
+	if exe, err := os.Executable(); err == nil {
+		// Build IDs are only available for ELF executables
+		m.buildID, m.gnuBuildID, _ = buildid.ReadFile(exe)
+	}
+	m.anchorFunc, m.anchor = anchor()
+	return m
+})
+
+// anchor returns the name and runtime entry address of itself.
+func anchor() (string, uintptr) {
+	fn := runtime.FuncForPC(reflect.ValueOf(anchor).Pointer())
+	return fn.Name(), fn.Entry()
+}
+
+// EncodeStack returns the deepest stack trace of the error chain in raw form
+// with the build metadata of the running executable, or "" if the chain has
+// no stack trace. No symbolization happens, which makes it suitable for high
+// volume crash shipping; see DecodeStack.
+func EncodeStack(err error) string {
+	stack := deepestStack(err)
+	if stack == nil {
+		return ""
+	}
+
+	m := currentBuild()
+	s := EncodedStack{
+		BuildID:    m.buildID,
+		GNUBuildID: m.gnuBuildID,
+		Module:     m.module,
+		Version:    m.version,
+		AnchorFunc: m.anchorFunc,
+		Anchor:     m.anchor,
+		PCs:        stack.pc,
+	}
+	return s.String()
+}
+
+// String encodes the stack as a single line of space separated fields.
+func (s EncodedStack) String() string {
+	var sb strings.Builder
+	sb.WriteString(encodedStackPrefix)
+
+	field := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&sb, " %s=%s", key, value)
+		}
+	}
+	field("buildid", s.BuildID)
+	field("gnubuildid", s.GNUBuildID)
+	if s.Module != "" {
+		field("module", s.Module+"@"+s.Version)
+	}
+	if s.AnchorFunc != "" {
+		field("anchor", s.AnchorFunc+"@"+strconv.FormatUint(uint64(s.Anchor), 16))
+	}
+
+	sb.WriteString(" pcs=")
+	for i, pc := range s.PCs {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.FormatUint(uint64(pc), 16))
+	}
+	return sb.String()
+}
+
+// DecodeStack parses a stack encoded by EncodeStack.
+func DecodeStack(text string) (*EncodedStack, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || fields[0] != encodedStackPrefix {
+		return nil, errors.New("zerr: not an encoded stack")
+	}
+
+	var s EncodedStack
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("zerr: invalid encoded stack field %q", field)
+		}
+
+		switch key {
+		case "buildid":
+			s.BuildID = value
+		case "gnubuildid":
+			s.GNUBuildID = value
+		case "module":
+			// Module paths cannot contain '@', versions can
+			s.Module, s.Version, _ = strings.Cut(value, "@")
+		case "anchor":
+			i := strings.LastIndexByte(value, '@')
+			if i < 0 {
+				return nil, fmt.Errorf("zerr: invalid encoded stack anchor %q", value)
+			}
+			addr, err := strconv.ParseUint(value[i+1:], 16, 64)
+			if err != nil {
+				return nil, fmt.Errorf("zerr: invalid encoded stack anchor %q: %w", value, err)
+			}
+			s.AnchorFunc, s.Anchor = value[:i], uintptr(addr)
+		case "pcs":
+			for hexPC := range strings.SplitSeq(value, ",") {
+				if hexPC == "" {
+					continue
+				}
+				pc, err := strconv.ParseUint(hexPC, 16, 64)
+				if err != nil {
+					return nil, fmt.Errorf("zerr: invalid encoded stack pc %q: %w", hexPC, err)
+				}
+				s.PCs = append(s.PCs, uintptr(pc))
+			}
+		default:
+			// Ignore unknown fields for forward compatibility
+		}
+	}
+	return &s, nil
+}
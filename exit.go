@@ -0,0 +1,121 @@
+// Package zerr provides process exit code mapping for command line programs.
+package zerr
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// Exit codes of sysexits.h, for use with RegisterExitCode, RegisterExitError
+// and ExitCoder.
+const (
+	ExitOK          = 0  // Successful termination
+	ExitFailure     = 1  // Unspecified failure, the default for errors
+	ExitUsage       = 64 // Command line usage error
+	ExitDataErr     = 65 // Data format error
+	ExitNoInput     = 66 // Cannot open input
+	ExitNoUser      = 67 // Addressee unknown
+	ExitNoHost      = 68 // Host name unknown
+	ExitUnavailable = 69 // Service unavailable
+	ExitSoftware    = 70 // Internal software error, the default for panics
+	ExitOSErr       = 71 // System error
+	ExitOSFile      = 72 // Critical OS file missing
+	ExitCantCreat   = 73 // Cannot create output file
+	ExitIOErr       = 74 // Input/output error
+	ExitTempFail    = 75 // Temporary failure, the user is invited to retry
+	ExitProtocol    = 76 // Remote error in protocol
+	ExitNoPerm      = 77 // Permission denied
+	ExitConfig      = 78 // Configuration error
+)
+
+// ExitCoder is implemented by errors that determine the exit code of the
+// process, such as *exec.ExitError. Negative exit codes are ignored.
+type ExitCoder interface {
+	ExitCode() int
+}
+
+// exitSentinel maps errors matching target with errors.Is to an exit code.
+type exitSentinel struct {
+	target error
+	code   int
+}
+
+var (
+	exitMu        sync.RWMutex
+	exitCodes     = map[string]int{CodePanic: ExitSoftware, CodeBug: ExitSoftware}
+	exitSentinels []exitSentinel
+
+	// exit and stderr are replaced in tests.
+	exit             = os.Exit
+	stderr io.Writer = os.Stderr
+)
+
+// RegisterExitCode makes ExitCode map errors carrying the zerr code to
+// exitCode. Errors converted from panics map to ExitSoftware by default.
+func RegisterExitCode(code string, exitCode int) {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	exitCodes[code] = exitCode
+}
+
+// RegisterExitError makes ExitCode map errors matching target, as reported
+// by errors.Is, to exitCode. Sentinels are checked in registration order.
+func RegisterExitError(target error, exitCode int) {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	exitSentinels = append(exitSentinels, exitSentinel{target: target, code: exitCode})
+}
+
+// ExitCode returns the process exit code for err: 0 for nil, otherwise the
+// exit code of the outermost ExitCoder in the chain, then the exit code
+// registered for the outermost registered zerr code, then that of the first
+// registered sentinel matching err, and ExitFailure if none applies.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	var coder ExitCoder
+	if errors.As(err, &coder) && coder.ExitCode() >= 0 {
+		return coder.ExitCode()
+	}
+
+	exitMu.RLock()
+	defer exitMu.RUnlock()
+
+	for e := range layers(err) {
+		if z, ok := e.(*Error); ok && z.extension().code != "" {
+			if code, ok := exitCodes[z.extension().code]; ok {
+				return code
+			}
+		}
+	}
+	for _, s := range exitSentinels {
+		if errors.Is(err, s.target) {
+			return s.code
+		}
+	}
+	return ExitFailure
+}
+
+// Exit reports err to standard error with Report and terminates the process
+// with the exit code returned by ExitCode. Errors converted from panics are
+// reported with their stack trace. If err is nil, Exit returns.
+//
+// Together with Defer, Exit handles both returned errors and panics in main:
+//
+//	func main() {
+//		defer zerr.Defer(zerr.Exit)
+//		zerr.Exit(run())
+//	}
+func Exit(err error) {
+	if err == nil {
+		return
+	}
+
+	_, panicked := PanicValue(err)
+	Report(stderr, err, &ReportOptions{Stack: panicked})
+	exit(ExitCode(err))
+}
@@ -0,0 +1,110 @@
+// Package zerr provides stable error fingerprints for grouping.
+package zerr
+
+import (
+	"encoding/hex"
+	"hash/fnv"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FingerprintOptions are options for Fingerprint.
+type FingerprintOptions struct {
+	// Frames is the number of top stack frames included in the fingerprint.
+	// Defaults to 5. A negative value excludes stack frames.
+	Frames int
+	// IgnoreLines excludes line numbers of the frames, so that the fingerprint
+	// survives edits that move code around.
+	IgnoreLines bool
+}
+
+var (
+	// quotedPattern matches double and single quoted values.
+	quotedPattern = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`)
+	// uuidPattern matches UUIDs.
+	uuidPattern = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	// numberPattern matches hexadecimal and decimal numbers.
+	numberPattern = regexp.MustCompile(`0[xX][0-9a-fA-F]+|[0-9]+(?:\.[0-9]+)?`)
+)
+
+// Fingerprint returns a hash of err that is stable across builds and deploys,
+// for grouping occurrences of the same error. It is computed from the code,
+// the messages of each layer with quoted values, UUIDs and numbers stripped,
+// and the functions and package-relative file names of the top frames of the
+// deepest stack trace, or of the return trace if there is no stack trace.
+// Raw program counters are not used. If opts is nil, the default options are used.
+func Fingerprint(err error, opts *FingerprintOptions) string {
+	if err == nil {
+		return ""
+	}
+
+	frames, ignoreLines := 5, false
+	if opts != nil {
+		if opts.Frames != 0 {
+			frames = opts.Frames
+		}
+		ignoreLines = opts.IgnoreLines
+	}
+
+	h := fnv.New64a()
+	write := func(s string) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+
+	write(Code(err))
+	for depth, e := 0, err; e != nil && depth < maxDepth; depth++ {
+		next := unwrap(e)
+		if zerr, ok := e.(*Error); ok {
+			write(normalizeMessage(zerr.message))
+		} else {
+			write(normalizeMessage(layerMessage(e, next)))
+		}
+		e = next
+	}
+
+	if frames > 0 {
+		for _, frame := range fingerprintFrames(err, frames) {
+			write(frame.Function)
+			write(relativeFile(frame))
+			if !ignoreLines {
+				write(strconv.Itoa(frame.Line))
+			}
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// normalizeMessage strips variable parts from an error message.
+func normalizeMessage(msg string) string {
+	msg = quotedPattern.ReplaceAllLiteralString(msg, `"?"`)
+	msg = uuidPattern.ReplaceAllLiteralString(msg, "<uuid>")
+	return numberPattern.ReplaceAllLiteralString(msg, "<n>")
+}
+
+// fingerprintFrames returns at most n top frames of the deepest stack trace,
+// or of the return trace if the chain has no stack trace.
+func fingerprintFrames(err error, n int) []Frame {
+	var frames []Frame
+	if stack := deepestStack(err); stack != nil {
+		stack.resolve()
+		frames = stack.frames
+	} else {
+		frames = ReturnTrace(err)
+	}
+	return frames[:min(n, len(frames))]
+}
+
+// relativeFile returns the file of frame relative to its package path, which
+// does not depend on where the code was checked out or built.
+func relativeFile(frame Frame) string {
+	pkg := frame.Function
+	slash := strings.LastIndexByte(pkg, '/')
+	if dot := strings.IndexByte(pkg[slash+1:], '.'); dot >= 0 {
+		pkg = pkg[:slash+1+dot]
+	}
+	return pkg + "/" + path.Base(frame.File)
+}
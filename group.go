@@ -0,0 +1,105 @@
+// Package zerr provides a goroutine group that converts panics into errors.
+package zerr
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Group runs goroutines and collects their errors, similar to errgroup.Group.
+// Panics in the goroutines are recovered and converted into errors, and every
+// error records the stack of the Go call that spawned its goroutine.
+//
+// A zero Group is valid, has no limit on the number of active goroutines and
+// does not cancel on error.
+type Group struct {
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
+	sem    chan struct{}
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// WithContext returns a new Group and an associated context derived from ctx.
+// The derived context is canceled the first time a goroutine returns an error
+// or panics, or the first time Wait returns, whichever occurs first.
+func WithContext(ctx context.Context) (*Group, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &Group{cancel: cancel}, ctx
+}
+
+// SetLimit limits the number of active goroutines in the group to at most n.
+// A negative value indicates no limit. The limit must not be modified while
+// any goroutines in the group are active.
+func (g *Group) SetLimit(n int) {
+	if n < 0 {
+		g.sem = nil
+		return
+	}
+	if len(g.sem) != 0 {
+		panic(fmt.Errorf("zerr: modify limit while %v goroutines in the group are still active", len(g.sem)))
+	}
+	g.sem = make(chan struct{}, n)
+}
+
+// Go calls f in a new goroutine, blocking until the goroutine can be added
+// without exceeding the limit set by SetLimit.
+func (g *Group) Go(f func() error) {
+	// Capture the spawn site before leaving the caller's goroutine
+	spawn := getOrCreateStack(2)
+
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.done()
+
+		if err := run(f); err != nil {
+			g.fail(&Error{cause: err, stack: spawn})
+		}
+	}()
+}
+
+// Wait blocks until all goroutines started with Go have returned, then returns
+// all of their errors combined with Join, or nil if none failed.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	if g.cancel != nil {
+		g.cancel(nil)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return Join(g.errs...)
+}
+
+// done releases the slot of a finished goroutine.
+func (g *Group) done() {
+	if g.sem != nil {
+		<-g.sem
+	}
+	g.wg.Done()
+}
+
+// fail records err and cancels the group context.
+func (g *Group) fail(err error) {
+	g.mu.Lock()
+	g.errs = append(g.errs, err)
+	g.mu.Unlock()
+
+	if g.cancel != nil {
+		g.cancel(err)
+	}
+}
+
+// run calls f, converting a panic into an error.
+func run(f func() error) (err error) {
+	defer Defer(func(recovered error) {
+		err = recovered
+	})
+	return f()
+}
@@ -0,0 +1,167 @@
+// Package zerr provides an slog.Handler middleware that expands errors in log records.
+package zerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// Schema selects which parts of an error chain are emitted when it is expanded.
+type Schema uint8
+
+const (
+	// SchemaChain emits the ordered messages of each layer as "chain".
+	SchemaChain Schema = 1 << iota
+	// SchemaStack emits the deepest captured stack trace as "stacktrace" and
+	// the recorded locations of the layers as "return_trace".
+	SchemaStack
+	// SchemaCode emits the outermost code as "code".
+	SchemaCode
+	// SchemaMetadata emits the metadata merged across all layers.
+	SchemaMetadata
+	// SchemaHelp emits the hints and documentation links accumulated across
+	// all layers as "hints" and "help_urls".
+	SchemaHelp
+
+	// DefaultSchema emits everything.
+	DefaultSchema = SchemaChain | SchemaStack | SchemaCode | SchemaMetadata | SchemaHelp
+)
+
+// HandlerOptions are options for a Handler.
+type HandlerOptions struct {
+	// Schema selects the fields emitted for zerr errors.
+	// The zero value means DefaultSchema.
+	Schema Schema
+}
+
+// Handler is an slog.Handler middleware that finds error values in any
+// attribute or group and expands them before passing the record on.
+//
+// Errors containing a *Error anywhere in their chain are expanded into a
+// flat group holding the full message and the fields selected by the schema.
+// Other errors are expanded into a group holding "message" and "type".
+type Handler struct {
+	next   slog.Handler
+	schema Schema
+}
+
+// NewHandler creates a Handler that expands errors and writes to next.
+// If opts is nil, the default options are used.
+func NewHandler(next slog.Handler, opts *HandlerOptions) *Handler {
+	schema := DefaultSchema
+	if opts != nil && opts.Schema != 0 {
+		schema = opts.Schema
+	}
+	return &Handler{next: next, schema: schema}
+}
+
+// Enabled implements slog.Handler.
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler.
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	found := false
+	r.Attrs(func(a slog.Attr) bool {
+		found = containsError(a.Value)
+		return !found
+	})
+	if !found {
+		// Happy path: nothing to expand
+		return h.next.Handle(ctx, r)
+	}
+
+	nr := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		nr.AddAttrs(h.expand(a))
+		return true
+	})
+	return h.next.Handle(ctx, nr)
+}
+
+// WithAttrs implements slog.Handler.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	expanded := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		expanded[i] = h.expand(a)
+	}
+	return &Handler{next: h.next.WithAttrs(expanded), schema: h.schema}
+}
+
+// WithGroup implements slog.Handler.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{next: h.next.WithGroup(name), schema: h.schema}
+}
+
+// expand replaces error values in the attribute, descending into groups.
+func (h *Handler) expand(a slog.Attr) slog.Attr {
+	if err, ok := attrError(a.Value); ok {
+		return slog.Attr{Key: a.Key, Value: h.errorValue(err)}
+	}
+
+	v := a.Value.Resolve()
+	if v.Kind() != slog.KindGroup {
+		return a
+	}
+
+	group := v.Group()
+	expanded := make([]slog.Attr, len(group))
+	for i, ga := range group {
+		expanded[i] = h.expand(ga)
+	}
+	return slog.Attr{Key: a.Key, Value: slog.GroupValue(expanded...)}
+}
+
+// errorValue returns the expanded representation of err.
+func (h *Handler) errorValue(err error) slog.Value {
+	var zerr *Error
+	if !errors.As(err, &zerr) {
+		return slog.GroupValue(
+			slog.String("message", err.Error()),
+			slog.String("type", fmt.Sprintf("%T", err)),
+		)
+	}
+	return slog.GroupValue(flatAttrs(err, h.schema)...)
+}
+
+// attrError returns the error held by v, if any.
+func attrError(v slog.Value) (error, bool) {
+	if v.Kind() != slog.KindAny && v.Kind() != slog.KindLogValuer {
+		return nil, false
+	}
+	err, ok := v.Any().(error)
+	if !ok {
+		return nil, false
+	}
+	// Guard against typed nil *Error values
+	if zerr, isZerr := err.(*Error); isZerr && zerr == nil {
+		return nil, false
+	}
+	return err, true
+}
+
+// containsError reports whether v holds an error, directly or inside a group.
+func containsError(v slog.Value) bool {
+	_, ok := findError(v)
+	return ok
+}
+
+// findError returns the first error held by v, directly or inside a group.
+func findError(v slog.Value) (error, bool) {
+	if err, ok := attrError(v); ok {
+		return err, true
+	}
+	v = v.Resolve()
+	if v.Kind() != slog.KindGroup {
+		return nil, false
+	}
+	for _, a := range v.Group() {
+		if err, ok := findError(a.Value); ok {
+			return err, true
+		}
+	}
+	return nil, false
+}
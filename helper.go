@@ -0,0 +1,96 @@
+// Package zerr provides helper frame marking for stack trace capture.
+package zerr
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// helperFuncs holds the names of functions marked by Helper.
+	helperFuncs sync.Map // map[string]struct{}
+	// helperPCs caches the call sites of Helper that have been registered.
+	helperPCs sync.Map // map[uintptr]struct{}
+	// hasHelpers is set once any function has been marked by Helper.
+	hasHelpers atomic.Bool
+)
+
+// Helper marks the calling function as an error helper, the equivalent of
+// testing.T.Helper. Frames of marked functions are trimmed from the top of
+// captured stack traces and skipped by single-frame caller locations, so that
+// wrappers around WithStack or WithCaller report their own callers:
+//
+//	func Internal(err error) error {
+//		zerr.Helper()
+//		return zerr.WithStack(zerr.WithCode(err, "INTERNAL"))
+//	}
+func Helper() {
+	var pc [1]uintptr
+	runtime.Callers(2, pc[:]) // Skip runtime.Callers and Helper
+	if _, ok := helperPCs.Load(pc[0]); ok {
+		return
+	}
+
+	frame, _ := runtime.CallersFrames(pc[:]).Next()
+	helperFuncs.Store(frame.Function, struct{}{})
+	helperPCs.Store(pc[0], struct{}{})
+	hasHelpers.Store(true)
+}
+
+// WithStackSkip is like WithStack but skips n additional frames above its
+// caller, for helpers that cannot call Helper.
+func WithStackSkip(err error, n int) error {
+	if err == nil {
+		return nil
+	}
+	z, ok := err.(*Error)
+	if !ok {
+		// Upgrade standard error to zerr.Error safely
+		z = &Error{cause: err}
+	}
+	newErr := z.clone()
+	newErr.stack = getOrCreateStack(2 + n)
+	return newErr
+}
+
+// isHelper reports whether the named function has been marked by Helper.
+func isHelper(function string) bool {
+	_, ok := helperFuncs.Load(function)
+	return ok
+}
+
+// helperFrames returns the number of leading program counters of pcs that
+// belong entirely to helper functions. Helpers inlined into their callers
+// share a program counter with them and are trimmed when resolving frames.
+func helperFrames(pcs []uintptr) int {
+	if !hasHelpers.Load() {
+		return 0
+	}
+	for i, pc := range pcs {
+		frames := runtime.CallersFrames([]uintptr{pc})
+		for {
+			frame, more := frames.Next()
+			if !isHelper(frame.Function) {
+				return i
+			}
+			if !more {
+				break
+			}
+		}
+	}
+	return 0
+}
+
+// trimHelpers drops leading frames of helper functions, keeping at least one.
+func trimHelpers(frames []Frame) []Frame {
+	if !hasHelpers.Load() {
+		return frames
+	}
+	for i, frame := range frames {
+		if !isHelper(frame.Function) {
+			return frames[i:]
+		}
+	}
+	return frames
+}
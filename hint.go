@@ -0,0 +1,81 @@
+// Package zerr provides hints and documentation links for errors.
+package zerr
+
+import "slices"
+
+// WithHint attaches a hint telling the user what to do next to an error, for
+// example "run `migrate up` first". Hints accumulate across the chain, see Hints.
+// If err is a standard error, it wraps it to attach the hint.
+func WithHint(err error, hint string) error {
+	if err == nil {
+		return nil
+	}
+	if z, ok := err.(*Error); ok {
+		return z.WithHint(hint)
+	}
+	// Upgrade standard error to zerr.Error safely
+	z := &Error{cause: err}
+	return z.WithHint(hint)
+}
+
+// WithHelpURL attaches a link to documentation about an error, replacing any
+// link previously attached to the same layer. Links accumulate across the
+// chain, see HelpURLs.
+// If err is a standard error, it wraps it to attach the link.
+func WithHelpURL(err error, url string) error {
+	if err == nil {
+		return nil
+	}
+	if z, ok := err.(*Error); ok {
+		return z.WithHelpURL(url)
+	}
+	// Upgrade standard error to zerr.Error safely
+	z := &Error{cause: err}
+	return z.WithHelpURL(url)
+}
+
+// WithHint attaches a hint telling the user what to do next to the error.
+func (e *Error) WithHint(hint string) *Error {
+	newErr := e.extend()
+	newErr.ext.hints = append(slices.Clip(newErr.ext.hints), hint)
+	return newErr
+}
+
+// WithHelpURL attaches a link to documentation about the error.
+func (e *Error) WithHelpURL(url string) *Error {
+	newErr := e.extend()
+	newErr.ext.url = url
+	return newErr
+}
+
+// Hints returns the hints attached to every layer of the error chain,
+// outermost first and without duplicates.
+func Hints(err error) []string {
+	hints, _ := collectHelp(err)
+	return hints
+}
+
+// HelpURLs returns the documentation links attached to every layer of the
+// error chain, outermost first and without duplicates.
+func HelpURLs(err error) []string {
+	_, urls := collectHelp(err)
+	return urls
+}
+
+// collectHelp returns the hints and documentation links of the error tree,
+// including the errors combined by Join.
+func collectHelp(err error) (hints, urls []string) {
+	for e := range layers(err) {
+		if z, ok := e.(*Error); ok && z.ext != nil {
+			for _, hint := range z.ext.hints {
+				if !slices.Contains(hints, hint) {
+					hints = append(hints, hint)
+				}
+			}
+			if z.ext.url != "" && !slices.Contains(urls, z.ext.url) {
+				urls = append(urls, z.ext.url)
+			}
+		}
+	}
+	return hints, urls
+}
@@ -0,0 +1,78 @@
+// Package buildid reads build IDs from ELF executables.
+package buildid
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/hex"
+)
+
+// ELF note types of build IDs.
+const (
+	noteGoBuildID  = 4
+	noteGNUBuildID = 3
+)
+
+// Read returns the Go build ID and the hex-encoded GNU build ID of an ELF
+// file. Missing build IDs are returned as empty strings.
+func Read(f *elf.File) (goID, gnuID string) {
+	if desc := note(f, ".note.go.buildid", "Go", noteGoBuildID); desc != nil {
+		goID = string(desc)
+	}
+	if desc := note(f, ".note.gnu.build-id", "GNU", noteGNUBuildID); desc != nil {
+		gnuID = hex.EncodeToString(desc)
+	}
+	return goID, gnuID
+}
+
+// ReadFile is like Read for the ELF file at path.
+func ReadFile(path string) (goID, gnuID string, err error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	goID, gnuID = Read(f)
+	return goID, gnuID, nil
+}
+
+// note returns the descriptor of the note with the given name and type in
+// the named section, or nil if there is none.
+func note(f *elf.File, section, name string, typ uint32) []byte {
+	s := f.Section(section)
+	if s == nil {
+		return nil
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil
+	}
+
+	// Each note is a header of name size, descriptor size and type, followed
+	// by the name and the descriptor, both padded to 4 bytes
+	for len(data) >= 12 {
+		nameSize := f.ByteOrder.Uint32(data[0:4])
+		descSize := f.ByteOrder.Uint32(data[4:8])
+		noteType := f.ByteOrder.Uint32(data[8:12])
+		data = data[12:]
+
+		nameEnd := align4(nameSize)
+		descEnd := nameEnd + align4(descSize)
+		if uint64(len(data)) < descEnd {
+			return nil
+		}
+
+		noteName := bytes.TrimRight(data[:nameSize], "\x00")
+		if noteType == typ && string(noteName) == name {
+			return data[nameEnd : nameEnd+uint64(descSize)]
+		}
+		data = data[descEnd:]
+	}
+	return nil
+}
+
+// align4 rounds n up to a multiple of 4.
+func align4(n uint32) uint64 {
+	return (uint64(n) + 3) &^ 3
+}
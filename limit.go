@@ -0,0 +1,307 @@
+// Package zerr provides deduplication and rate limiting of logged errors.
+package zerr
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxFingerprintFrames is the maximum number of stack frames in a limiter fingerprint.
+const maxFingerprintFrames = 8
+
+// LimiterOptions are options for a Limiter.
+type LimiterOptions struct {
+	// Burst is the number of errors with the same fingerprint emitted per window.
+	// Defaults to 10.
+	Burst int
+	// Window is the length of a rate limiting window. Defaults to one minute.
+	Window time.Duration
+	// Frames is the number of top stack frames included in the fingerprint.
+	// Defaults to 3, at most 8.
+	Frames int
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Limiter deduplicates and rate limits errors by fingerprint. The fingerprint
+// is built from the code, the messages of the zerr layers with numbers, quoted
+// strings and UUIDs normalized as in Fingerprint, and the program counters of
+// the top frames of the deepest stack, including those of the errors combined
+// by Join, so it is cheap to compute but only stable within a single process.
+//
+// The first Burst errors of a fingerprint are emitted per window. Errors
+// beyond that are suppressed and counted; the count is reported on the next
+// emitted error of the fingerprint or as a summary once the window has ended.
+//
+// Summaries are only emitted when a later error passes through Log or
+// Handler. A fingerprint that stops occurring after a burst is not reported
+// until then, unless Run reports summaries periodically or Flush is called.
+type Limiter struct {
+	burst  int
+	window time.Duration
+	frames int
+	now    func() time.Time
+
+	mu        sync.Mutex
+	entries   map[limiterKey]*limiterEntry
+	lastFlush time.Time
+}
+
+// limiterKey is the fingerprint of an error.
+type limiterKey struct {
+	code    string
+	message string
+	pc      [maxFingerprintFrames]uintptr
+}
+
+// limiterEntry holds the state of a single fingerprint.
+type limiterEntry struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// Summary reports errors suppressed by a Limiter.
+type Summary struct {
+	// Message is the normalized message of the suppressed errors.
+	Message string
+	// Code is the code of the suppressed errors.
+	Code string
+	// Suppressed is the number of suppressed errors.
+	Suppressed int
+}
+
+// NewLimiter creates a Limiter. If opts is nil, the default options are used.
+func NewLimiter(opts *LimiterOptions) *Limiter {
+	l := &Limiter{
+		burst:   10,
+		window:  time.Minute,
+		frames:  3,
+		now:     time.Now,
+		entries: make(map[limiterKey]*limiterEntry),
+	}
+	if opts == nil {
+		return l
+	}
+	if opts.Burst > 0 {
+		l.burst = opts.Burst
+	}
+	if opts.Window > 0 {
+		l.window = opts.Window
+	}
+	if opts.Frames > 0 {
+		l.frames = min(opts.Frames, maxFingerprintFrames)
+	}
+	if opts.Now != nil {
+		l.now = opts.Now
+	}
+	return l
+}
+
+// Allow reports whether err should be emitted. When it is, suppressed is the
+// number of errors with the same fingerprint dropped since it was last emitted.
+func (l *Limiter) Allow(err error) (ok bool, suppressed int) {
+	key := l.fingerprint(err)
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, found := l.entries[key]
+	if !found {
+		entry = &limiterEntry{start: now}
+		l.entries[key] = entry
+	}
+
+	if now.Sub(entry.start) >= l.window {
+		// Start a new window, reporting what the previous one dropped
+		suppressed = entry.suppressed
+		entry.start = now
+		entry.count = 0
+		entry.suppressed = 0
+	}
+
+	if entry.count < l.burst {
+		entry.count++
+		return true, suppressed
+	}
+
+	entry.suppressed++
+	return false, 0
+}
+
+// Flush returns summaries of the errors suppressed in windows that have ended
+// and were not reported by a later occurrence, and forgets idle fingerprints.
+func (l *Limiter) Flush() []Summary {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.flushLocked(l.now())
+}
+
+// flushLocked implements Flush. l.mu must be held.
+func (l *Limiter) flushLocked(now time.Time) []Summary {
+	l.lastFlush = now
+
+	var summaries []Summary
+	for key, entry := range l.entries {
+		if now.Sub(entry.start) < l.window {
+			continue
+		}
+		if entry.suppressed > 0 {
+			summaries = append(summaries, Summary{
+				Message:    key.message,
+				Code:       key.code,
+				Suppressed: entry.suppressed,
+			})
+		}
+		delete(l.entries, key)
+	}
+	return summaries
+}
+
+// dueSummaries flushes the limiter if a window has passed since the last flush.
+func (l *Limiter) dueSummaries() []Summary {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastFlush) < l.window {
+		return nil
+	}
+	return l.flushLocked(now)
+}
+
+// fingerprint computes the limiter key of err.
+func (l *Limiter) fingerprint(err error) limiterKey {
+	var (
+		key      limiterKey
+		messages []string
+	)
+
+	walk(err, func(err error, _ int) bool {
+		if zerr, ok := err.(*Error); ok {
+			if key.code == "" {
+				key.code = zerr.extension().code
+			}
+			if zerr.message != "" {
+				messages = append(messages, zerr.message)
+			}
+		}
+		return true
+	})
+
+	if len(messages) == 0 {
+		// Fall back to the full message of standard errors
+		messages = append(messages, err.Error())
+	}
+	key.message = normalizeMessage(strings.Join(messages, ": "))
+	if stack := deepestStack(err); stack != nil {
+		copy(key.pc[:l.frames], stack.pc)
+	}
+	return key
+}
+
+// Run logs the summaries of suppressed errors to logger as warnings once per
+// window until ctx is done, so that errors that stop occurring are reported
+// too. It is typically started in its own goroutine:
+//
+//	go limiter.Run(ctx, logger)
+func (l *Limiter) Run(ctx context.Context, logger *slog.Logger) {
+	ticker := time.NewTicker(l.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, s := range l.Flush() {
+				logger.LogAttrs(ctx, slog.LevelWarn, "suppressed repeated errors", s.attrs()...)
+			}
+		}
+	}
+}
+
+// Handler returns an slog.Handler that applies the limiter to records holding
+// an error in any attribute before passing them to next. Emitted records carry
+// a "suppressed" attribute when errors were dropped, and summaries of ended
+// windows are emitted as warnings.
+func (l *Limiter) Handler(next slog.Handler) slog.Handler {
+	return &limitHandler{next: next, limiter: l}
+}
+
+// limitHandler is the slog.Handler returned by Limiter.Handler.
+type limitHandler struct {
+	next    slog.Handler
+	limiter *Limiter
+}
+
+// Enabled implements slog.Handler.
+func (h *limitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler.
+func (h *limitHandler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	r.Attrs(func(a slog.Attr) bool {
+		err, _ = findError(a.Value)
+		return err == nil
+	})
+	if err == nil {
+		return h.next.Handle(ctx, r)
+	}
+
+	if e := h.emitSummaries(ctx, r.PC); e != nil {
+		return e
+	}
+
+	ok, suppressed := h.limiter.Allow(err)
+	if !ok {
+		return nil
+	}
+	if suppressed > 0 {
+		r = r.Clone()
+		r.AddAttrs(slog.Int("suppressed", suppressed))
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// emitSummaries writes the due summaries of the limiter to next.
+func (h *limitHandler) emitSummaries(ctx context.Context, pc uintptr) error {
+	for _, s := range h.limiter.dueSummaries() {
+		if !h.next.Enabled(ctx, slog.LevelWarn) {
+			return nil
+		}
+		r := slog.NewRecord(h.limiter.now(), slog.LevelWarn, "suppressed repeated errors", pc)
+		r.AddAttrs(s.attrs()...)
+		if err := h.next.Handle(ctx, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithAttrs implements slog.Handler.
+func (h *limitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &limitHandler{next: h.next.WithAttrs(attrs), limiter: h.limiter}
+}
+
+// WithGroup implements slog.Handler.
+func (h *limitHandler) WithGroup(name string) slog.Handler {
+	return &limitHandler{next: h.next.WithGroup(name), limiter: h.limiter}
+}
+
+// attrs returns the log attributes of the summary.
+func (s Summary) attrs() []slog.Attr {
+	attrs := []slog.Attr{slog.String("error", s.Message)}
+	if s.Code != "" {
+		attrs = append(attrs, slog.String("code", s.Code))
+	}
+	return append(attrs, slog.Int("suppressed", s.Suppressed))
+}
@@ -3,43 +3,183 @@ package zerr
 
 import (
 	"context"
+	"fmt"
+	"iter"
 	"log/slog"
+	"strings"
+	"sync/atomic"
 )
 
+// maxDepth is a safety limit to prevent infinite loops in cyclic error chains.
+const maxDepth = 100
+
+// LogOption configures Log.
+type LogOption func(*logConfig)
+
+// logConfig holds the configuration of a Log call.
+type logConfig struct {
+	limiter     *Limiter
+	skipLogged  bool
+	loggedLevel slog.Level
+	downgrade   bool
+}
+
+// SkipLogged makes Log ignore errors that have already been logged.
+func SkipLogged() LogOption {
+	return func(c *logConfig) {
+		c.skipLogged = true
+	}
+}
+
+// DowngradeLogged makes Log log errors that have already been logged at level
+// instead of slog.LevelError.
+func DowngradeLogged(level slog.Level) LogOption {
+	return func(c *logConfig) {
+		c.loggedLevel = level
+		c.downgrade = true
+	}
+}
+
+// RateLimit makes Log drop errors suppressed by l and log the summaries of
+// suppressed errors as warnings.
+func RateLimit(l *Limiter) LogOption {
+	return func(c *logConfig) {
+		c.limiter = l
+	}
+}
+
 // Log logs an error using the provided slog.Logger with structured fields.
-func Log(ctx context.Context, logger *slog.Logger, err error) {
-	logger.ErrorContext(ctx, err.Error(), logFields(err)...)
+// Once the record has been emitted, it returns err wrapped in a layer marked
+// as logged, see IsLogged; return that error rather than err so that callers
+// up the stack know it was reported:
+//
+//	if err != nil {
+//		return zerr.Log(ctx, logger, err)
+//	}
+//
+// The layers of err itself are never modified, so shared errors such as
+// sentinels are not marked. If the error is skipped, suppressed by a Limiter
+// or its level is disabled, err is returned unchanged. If err is nil, Log
+// returns nil.
+func Log(ctx context.Context, logger *slog.Logger, err error, opts ...LogOption) error {
+	if err == nil {
+		return nil
+	}
+
+	var cfg logConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	level := slog.LevelError
+	if IsLogged(err) {
+		if cfg.skipLogged {
+			return err
+		}
+		if cfg.downgrade {
+			level = cfg.loggedLevel
+		}
+	}
+	if !logger.Enabled(ctx, level) {
+		return err
+	}
+
+	var suppressed int
+	if cfg.limiter != nil {
+		for _, s := range cfg.limiter.dueSummaries() {
+			logger.LogAttrs(ctx, slog.LevelWarn, "suppressed repeated errors", s.attrs()...)
+		}
+
+		var ok bool
+		if ok, suppressed = cfg.limiter.Allow(err); !ok {
+			return err
+		}
+	}
+
+	fields := logFields(err)
+	if suppressed > 0 {
+		fields = append(fields, slog.Int("suppressed", suppressed))
+	}
+	logger.Log(ctx, level, err.Error(), fields...)
+
+	return &Error{cause: err, ext: &errorExt{logged: true}}
+}
+
+// IsLogged reports whether err, or any error it wraps, has been logged by Log,
+// that is whether its chain contains an error returned by Log. Errors combined
+// by Join are only logged if every one of them is, so that SkipLogged does not
+// drop the failures that have not been reported yet.
+func IsLogged(err error) bool {
+	return isLogged(err, 0)
+}
+
+// isLogged implements IsLogged for the chain of err at the given depth.
+func isLogged(err error, depth int) bool {
+	for ; err != nil && depth < maxDepth; depth++ {
+		if zerr, ok := err.(*Error); ok && zerr.extension().logged {
+			return true
+		}
+		if m, ok := err.(interface{ Unwrap() []error }); ok {
+			errs := m.Unwrap()
+			for _, e := range errs {
+				if !isLogged(e, depth+1) {
+					return false
+				}
+			}
+			return len(errs) > 0
+		}
+		err = unwrap(err)
+	}
+	return false
 }
 
 // logFields extracts structured fields from an error for logging.
 func logFields(err error) []any {
 	var fields []any
-	const maxDepth = 100 // Safety limit to prevent infinite loops in cyclic error chains
-	depth := 0
-
-	// Traverse the error chain
-	for err != nil {
-		// Guard against infinite loops
-		if depth >= maxDepth {
-			fields = append(fields, slog.String("zerr.error", "max recursion depth exceeded"))
-			break
-		}
-		depth++
+	var caller uintptr
 
+	// Traverse the error tree, including the errors combined by Join
+	truncated := walk(err, func(err error, _ int) bool {
 		if zerr, ok := err.(*Error); ok {
 			// Add metadata fields
 			for _, meta := range zerr.metadata {
 				fields = append(fields, slog.Any(meta.key.Value(), meta.value))
 			}
 
-			// Add stack trace if available
-			if zerr.stack != nil && zerr.stack.formatted != "" {
-				fields = append(fields, slog.String("stacktrace", zerr.stack.formatted))
+			// Add stack trace if available; it is formatted lazily by the handler
+			if zerr.stack != nil {
+				fields = append(fields, slog.Any("stacktrace", stackValue{zerr.stack}))
+			}
+
+			// Remember the outermost caller location
+			if caller == 0 {
+				caller = zerr.caller
 			}
 		}
+		return true
+	})
 
-		// Move to the next error in the chain
-		err = unwrap(err)
+	// Guard against infinite loops
+	if truncated {
+		fields = append(fields, slog.String("zerr.error", "max recursion depth exceeded"))
+	}
+
+	if caller != 0 {
+		fields = append(fields, slog.Any("caller", callerValue{caller}))
+	}
+
+	// Add the hints and documentation links accumulated across the chain
+	hints, urls := collectHelp(err)
+	if len(hints) > 0 {
+		fields = append(fields, slog.Any("hints", hints))
+	}
+	if len(urls) > 0 {
+		fields = append(fields, slog.Any("help_urls", urls))
+	}
+
+	// Add the return trace when more than one layer recorded its location
+	if trace := returnTracePCs(err); len(trace) > 1 {
+		fields = append(fields, slog.Any("return_trace", traceValue{trace}))
 	}
 
 	return fields
@@ -53,22 +193,246 @@ func unwrap(err error) error {
 	return nil
 }
 
+// maxLayers is a safety limit on the number of layers visited in an error
+// tree, which guards against cycles through errors combined by Join.
+const maxLayers = maxDepth * maxDepth
+
+// walk calls yield for each layer of the error tree with its depth, in
+// depth-first order, descending into every error of an Unwrap() []error
+// method such as those combined by Join. It stops when yield returns false
+// and reports whether the tree was cut short by the maxDepth or maxLayers
+// safety limits.
+func walk(err error, yield func(err error, depth int) bool) (truncated bool) {
+	visited := 0
+	var visit func(err error, depth int) bool
+	visit = func(err error, depth int) bool {
+		for ; err != nil; depth++ {
+			if depth >= maxDepth || visited >= maxLayers {
+				truncated = true
+				return false
+			}
+			visited++
+			if !yield(err, depth) {
+				return false
+			}
+			if m, ok := err.(interface{ Unwrap() []error }); ok {
+				for _, e := range m.Unwrap() {
+					if !visit(e, depth+1) {
+						return false
+					}
+				}
+				return true
+			}
+			err = unwrap(err)
+		}
+		return true
+	}
+	visit(err, 0)
+	return truncated
+}
+
+// layers returns an iterator over the layers of the error tree in the order
+// of walk.
+func layers(err error) iter.Seq[error] {
+	return func(yield func(error) bool) {
+		walk(err, func(err error, _ int) bool {
+			return yield(err)
+		})
+	}
+}
+
+// flatChain is the flat representation of an error chain.
+type flatChain struct {
+	message string
+	chain   []string
+	joined  bool
+	meta    []slog.Attr
+	code    string
+	stack   *stackCacheEntry
+	trace   []uintptr
+	hints   []string
+	urls    []string
+}
+
+// flatten walks an error tree and returns the full message, the outermost
+// code, the ordered messages of each layer, the metadata merged across all
+// layers (outer layers win), the deepest captured stack, the return trace and
+// the accumulated hints and documentation links. Errors combined by Join
+// contribute the messages of their layers in order; joined reports whether
+// the tree branches before its first message.
+func flatten(err error) flatChain {
+	f := flatChain{
+		message: err.Error(),
+		trace:   returnTracePCs(err),
+	}
+	f.hints, f.urls = collectHelp(err)
+	stackDepth := -1
+	walk(err, func(err error, depth int) bool {
+		if zerr, ok := err.(*Error); ok {
+			if zerr.message != "" {
+				f.chain = append(f.chain, zerr.message)
+			}
+			if f.code == "" {
+				f.code = zerr.extension().code
+			}
+			if zerr.stack != nil && depth > stackDepth {
+				f.stack, stackDepth = zerr.stack, depth
+			}
+			for _, m := range zerr.metadata {
+				if !hasAttr(f.meta, m.key.Value()) {
+					f.meta = append(f.meta, slog.Any(m.key.Value(), m.value))
+				}
+			}
+		} else if _, ok := err.(interface{ Unwrap() []error }); ok {
+			f.joined = f.joined || len(f.chain) == 0
+		} else if msg := layerMessage(err, unwrap(err)); msg != "" {
+			f.chain = append(f.chain, msg)
+		}
+		return true
+	})
+	return f
+}
+
+// flatAttrs returns the flat representation of an error chain as attributes,
+// restricted to the parts selected by schema.
+func flatAttrs(err error, schema Schema) []slog.Attr {
+	f := flatten(err)
+
+	attrs := make([]slog.Attr, 0, len(f.meta)+6)
+	attrs = append(attrs, slog.String("message", f.message))
+	if schema&SchemaCode != 0 && f.code != "" {
+		attrs = append(attrs, slog.String("code", f.code))
+	}
+	if schema&SchemaChain != 0 && len(f.chain) > 0 {
+		attrs = append(attrs, slog.Any("chain", f.chain))
+	}
+	if schema&SchemaMetadata != 0 {
+		attrs = append(attrs, f.meta...)
+	}
+	if schema&SchemaStack != 0 && f.stack != nil {
+		attrs = append(attrs, slog.Any("stacktrace", stackValue{f.stack}))
+	}
+	if schema&SchemaStack != 0 && len(f.trace) > 0 {
+		attrs = append(attrs, slog.Any("return_trace", traceValue{f.trace}))
+	}
+	if schema&SchemaHelp != 0 && len(f.hints) > 0 {
+		attrs = append(attrs, slog.Any("hints", f.hints))
+	}
+	if schema&SchemaHelp != 0 && len(f.urls) > 0 {
+		attrs = append(attrs, slog.Any("help_urls", f.urls))
+	}
+	return attrs
+}
+
+// layerMessage returns the part of err's message contributed by err itself,
+// stripping the message of the next error when it is appended as a suffix.
+func layerMessage(err, next error) string {
+	msg := err.Error()
+	if next != nil {
+		msg = strings.TrimSuffix(msg, next.Error())
+		msg = strings.TrimSuffix(msg, ": ")
+	}
+	return msg
+}
+
+// hasAttr reports whether attrs contains an attribute with the given key.
+func hasAttr(attrs []slog.Attr, key string) bool {
+	for _, a := range attrs {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// LogFormat selects how (*Error).LogValue represents an error chain.
+type LogFormat int32
+
+const (
+	// LogFormatNested emits each layer as a group with the next layer nested under "cause".
+	LogFormatNested LogFormat = iota
+	// LogFormatFlat emits a single group with the full message, the ordered
+	// messages of each layer as "chain", the merged metadata and the deepest stack.
+	LogFormatFlat
+)
+
+// logFormat holds the global LogFormat.
+var logFormat atomic.Int32
+
+// SetLogFormat sets the representation used by (*Error).LogValue.
+// The default is LogFormatNested.
+func SetLogFormat(format LogFormat) {
+	logFormat.Store(int32(format))
+}
+
+// Flat returns err wrapped so that it logs with the flat representation
+// regardless of the global LogFormat. The result still behaves as err for
+// errors.Is, errors.As and Error. If err is nil, Flat returns nil.
+func Flat(err error) error {
+	if err == nil {
+		return nil
+	}
+	return flatError{err}
+}
+
+// flatError is an error that logs with the flat representation.
+type flatError struct {
+	error
+}
+
+// Unwrap implements the unwrap interface for error chaining.
+func (f flatError) Unwrap() error {
+	return f.error
+}
+
+// Format implements the fmt.Formatter interface by formatting the wrapped
+// error with the same verb and flags, so that %+v still prints its stack trace.
+func (f flatError) Format(s fmt.State, verb rune) {
+	fmt.Fprintf(s, fmt.FormatString(s, verb), f.error)
+}
+
+// LogValue implements slog.LogValuer.
+func (f flatError) LogValue() slog.Value {
+	return slog.GroupValue(flatAttrs(f.error, DefaultSchema)...)
+}
+
 // LogValue implements slog.LogValuer for automatic formatting when logged.
 func (e *Error) LogValue() slog.Value {
+	if LogFormat(logFormat.Load()) == LogFormatFlat {
+		return slog.GroupValue(flatAttrs(e, DefaultSchema)...)
+	}
+
 	// Create attributes for all metadata
-	attrs := make([]slog.Attr, 0, len(e.metadata)+2) // +2 for message and cause
+	attrs := make([]slog.Attr, 0, len(e.metadata)+7) // +7 for message, code, hints, help URL, caller, stack and cause
 
 	// Add the error message
 	attrs = append(attrs, slog.String("msg", e.message))
 
+	// Add code if present
+	ext := e.extension()
+	if ext.code != "" {
+		attrs = append(attrs, slog.String("code", ext.code))
+	}
+
 	// Add metadata
 	for _, meta := range e.metadata {
 		attrs = append(attrs, slog.Any(meta.key.Value(), meta.value))
 	}
 
-	// Add stack trace if present
-	if e.stack != nil && e.stack.formatted != "" {
-		attrs = append(attrs, slog.String("stacktrace", e.stack.formatted))
+	// Add hints and documentation link if present
+	if len(ext.hints) > 0 {
+		attrs = append(attrs, slog.Any("hints", ext.hints))
+	}
+	if ext.url != "" {
+		attrs = append(attrs, slog.String("help_url", ext.url))
+	}
+
+	// Add caller location and stack trace if present; they are formatted lazily by the handler
+	if e.caller != 0 {
+		attrs = append(attrs, slog.Any("caller", callerValue{e.caller}))
+	}
+	if e.stack != nil {
+		attrs = append(attrs, slog.Any("stacktrace", stackValue{e.stack}))
 	}
 
 	// Add cause if present
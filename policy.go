@@ -0,0 +1,257 @@
+// Package zerr provides policies for capturing stack traces automatically.
+package zerr
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Capture selects the operations that capture a stack trace automatically.
+type Capture uint8
+
+const (
+	// CaptureNew captures a stack trace in New.
+	CaptureNew Capture = 1 << iota
+	// CaptureWrapForeign captures a stack trace in Wrap when the wrapped error
+	// is not a *Error, i.e. where an error enters the zerr world.
+	CaptureWrapForeign
+	// CaptureWrap captures a stack trace in every Wrap.
+	CaptureWrap
+
+	// CaptureNever disables automatic stack traces.
+	CaptureNever Capture = 0
+)
+
+// StackPolicy configures automatic stack trace capture in New and Wrap.
+// The zero value never captures.
+type StackPolicy struct {
+	// Capture selects the operations that capture a stack trace.
+	Capture Capture
+	// Rate is the probability in (0, 1) that an eligible operation captures a
+	// stack trace. Values outside that range capture every time.
+	Rate float64
+	// First is the number of eligible operations per call site that capture
+	// a stack trace before Every applies. Per-site sampling is disabled if
+	// both First and Every are zero.
+	First int
+	// Every makes one in every Every eligible operations per call site
+	// capture a stack trace once First is exhausted. Zero means none.
+	Every int
+	// IfMissing skips capturing in Wrap when the wrapped chain already
+	// carries a stack trace.
+	IfMissing bool
+}
+
+// stackPolicy is a StackPolicy with its per-site sampling state.
+type stackPolicy struct {
+	StackPolicy
+	sites sync.Map // map[uintptr]*atomic.Uint64
+}
+
+// Hook bits reported by hooks.
+const (
+	hookReturnTraces uint32 = 1 << iota
+	hookStackPolicy
+	hookProfile
+)
+
+var (
+	// hooks is non-zero when New and Wrap have any work beyond allocating,
+	// so that the disabled path costs a single atomic load. Its bits are
+	// loaded with atomic.LoadUint32 because the Load method of atomic.Uint32
+	// would push Wrap over the inlining budget.
+	hooks struct{ bits uint32 }
+	// globalPolicy is the policy applied by New and Wrap, nil if disabled.
+	globalPolicy atomic.Pointer[stackPolicy]
+)
+
+func init() {
+	if env, ok := os.LookupEnv("ZERR_STACK"); ok {
+		// Invalid values are ignored, like unknown GODEBUG settings
+		if p, err := ParseStackPolicy(env); err == nil {
+			SetStackPolicy(p)
+		}
+	}
+}
+
+// SetStackPolicy sets the policy applied by New and Wrap. The initial policy
+// is read from the ZERR_STACK environment variable, see ParseStackPolicy.
+func SetStackPolicy(p StackPolicy) {
+	globalPolicy.Store(newStackPolicy(p))
+	updateHooks()
+}
+
+// newStackPolicy returns the internal form of p, or nil if it never captures.
+func newStackPolicy(p StackPolicy) *stackPolicy {
+	if p.Capture == CaptureNever {
+		return nil
+	}
+	return &stackPolicy{StackPolicy: p}
+}
+
+// updateHooks recomputes hooks from the global settings.
+func updateHooks() {
+	var h uint32
+	if returnTraces.Load() {
+		h |= hookReturnTraces
+	}
+	if globalPolicy.Load() != nil {
+		h |= hookStackPolicy
+	}
+	if activeProfile.Load() != nil {
+		h |= hookProfile
+	}
+	atomic.StoreUint32(&hooks.bits, h)
+}
+
+// ParseStackPolicy parses a policy in the format of the ZERR_STACK environment
+// variable: a comma-separated list of operations ("new", "foreign", "wrap" or
+// "never"), "ifmissing", and sampling options ("rate=R", "first=N" and
+// "every=M"):
+//
+//	ZERR_STACK=new,foreign,first=10,every=100
+func ParseStackPolicy(s string) (StackPolicy, error) {
+	var p StackPolicy
+	for field := range strings.SplitSeq(s, ",") {
+		field = strings.TrimSpace(field)
+		name, value, hasValue := strings.Cut(field, "=")
+
+		var err error
+		switch {
+		case field == "" || field == "never":
+		case field == "new":
+			p.Capture |= CaptureNew
+		case field == "foreign":
+			p.Capture |= CaptureWrapForeign
+		case field == "wrap":
+			p.Capture |= CaptureWrap
+		case field == "ifmissing":
+			p.IfMissing = true
+		case hasValue && name == "rate":
+			p.Rate, err = strconv.ParseFloat(value, 64)
+		case hasValue && name == "first":
+			p.First, err = strconv.Atoi(value)
+		case hasValue && name == "every":
+			p.Every, err = strconv.Atoi(value)
+		default:
+			return StackPolicy{}, fmt.Errorf("zerr: invalid stack policy field %q", field)
+		}
+		if err != nil {
+			return StackPolicy{}, fmt.Errorf("zerr: invalid stack policy field %q: %w", field, err)
+		}
+	}
+	return p, nil
+}
+
+// Internal capture points of New and Wrap, matched against Capture.
+const (
+	captureNew         = CaptureNew
+	captureWrapForeign = CaptureWrapForeign | CaptureWrap
+	captureWrapZerr    = CaptureWrap
+)
+
+// wrapCapture returns the capture point of wrapping err.
+func wrapCapture(err error) Capture {
+	if _, ok := err.(*Error); ok {
+		return captureWrapZerr
+	}
+	return captureWrapForeign
+}
+
+// instrument records the return trace location and, if the policy selects
+// the capture point, the stack trace of the caller of New or Wrap on e, and
+// counts e in the active error profile. skip is the number of frames between
+// instrument and New or Wrap.
+//
+//go:noinline
+func instrument(e *Error, p *stackPolicy, point Capture, skip int) {
+	pc := callerPC(1 + skip)
+	if returnTraces.Load() {
+		e.caller = pc
+	}
+	if p != nil && p.Capture&point != 0 && p.needsStack(e) && p.sample(pc) {
+		e.stack = getOrCreateStack(3 + skip) // Skip instrument and New or Wrap
+	}
+	if prof := activeProfile.Load(); prof != nil {
+		stack := e.stack
+		if stack == nil {
+			stack = getOrCreateStack(3 + skip)
+		}
+		prof.add(stack)
+	}
+}
+
+// needsStack reports whether the policy allows capturing a stack for e given
+// the stacks already carried by its chain.
+func (p *stackPolicy) needsStack(e *Error) bool {
+	return !p.IfMissing || e.cause == nil || deepestStack(e.cause) == nil
+}
+
+// sample reports whether an eligible operation at the call site pc captures.
+func (p *stackPolicy) sample(pc uintptr) bool {
+	if p.First > 0 || p.Every > 0 {
+		counter, ok := p.sites.Load(pc)
+		if !ok {
+			counter, _ = p.sites.LoadOrStore(pc, new(atomic.Uint64))
+		}
+		n := counter.(*atomic.Uint64).Add(1)
+		if n > uint64(p.First) && (p.Every <= 0 || (n-uint64(p.First))%uint64(p.Every) != 0) {
+			return false
+		}
+	}
+	if p.Rate > 0 && p.Rate < 1 && rand.Float64() >= p.Rate {
+		return false
+	}
+	return true
+}
+
+// Factory creates errors with its own stack policy, typically one per package:
+//
+//	var errs = zerr.NewFactory(zerr.StackPolicy{Capture: zerr.CaptureNew})
+//
+//	func load() error {
+//		return errs.New("config not found")
+//	}
+//
+// Return traces still follow the global setting.
+type Factory struct {
+	policy *stackPolicy
+}
+
+// NewFactory creates a Factory with the given policy.
+func NewFactory(p StackPolicy) *Factory {
+	return &Factory{policy: newStackPolicy(p)}
+}
+
+// New creates a new error with the given message, like New.
+func (f *Factory) New(message string) error {
+	newErr := &Error{
+		message: message,
+	}
+	if f.policy != nil || atomic.LoadUint32(&hooks.bits)&^hookStackPolicy != 0 {
+		instrument(newErr, f.policy, captureNew, 0)
+	}
+	return newErr
+}
+
+// Wrap wraps an existing error with an additional message, like Wrap.
+// If err is nil, Wrap returns nil.
+func (f *Factory) Wrap(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+
+	newErr := &Error{
+		message: message,
+		cause:   err,
+	}
+	if f.policy != nil || atomic.LoadUint32(&hooks.bits)&^hookStackPolicy != 0 {
+		instrument(newErr, f.policy, wrapCapture(err), 0)
+	}
+	return newErr
+}
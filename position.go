@@ -0,0 +1,268 @@
+// Package zerr provides source positions for parse and configuration errors.
+package zerr
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// positionKey is the metadata key under which At stores positions.
+const positionKey = "position"
+
+// Position is a location in a source file. Line and Col are 1-based, Col
+// counting bytes, and Offset is the 0-based byte offset; zero Line or Col
+// means unknown. A position without a Line is located by its Offset, so the
+// zero Offset refers to the start of the file.
+type Position struct {
+	File   string
+	Line   int
+	Col    int
+	Offset int
+}
+
+// String returns the position in the form "file:line:col", omitting unknown
+// parts, or "file:#offset" for a position without a Line.
+func (p Position) String() string {
+	s := p.File
+	if s != "" {
+		s += ":"
+	}
+	if p.Line <= 0 {
+		return s + "#" + strconv.Itoa(p.Offset)
+	}
+	s += strconv.Itoa(p.Line)
+	if p.Col > 0 {
+		s += ":" + strconv.Itoa(p.Col)
+	}
+	return s
+}
+
+// Range is a span of source between Start and the position just after its
+// last byte, End. A zero End makes it a single position.
+type Range struct {
+	Start Position
+	End   Position
+}
+
+// String returns the range in the form "file:line:col", followed by "-col" or
+// "-line:col" for the end of the range if known.
+func (r Range) String() string {
+	s := r.Start.String()
+	switch {
+	case r.End.Line == 0 || r.End == r.Start:
+	case r.End.Line == r.Start.Line && r.End.Col > 0:
+		s += "-" + strconv.Itoa(r.End.Col)
+	case r.End.Col > 0:
+		s += "-" + strconv.Itoa(r.End.Line) + ":" + strconv.Itoa(r.End.Col)
+	default:
+		s += "-" + strconv.Itoa(r.End.Line)
+	}
+	return s
+}
+
+// LogValue implements slog.LogValuer, omitting unknown fields. The offset is
+// always included for a position without a Line.
+func (r Range) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, 6)
+	if r.Start.File != "" {
+		attrs = append(attrs, slog.String("file", r.Start.File))
+	}
+	if r.Start.Line > 0 {
+		attrs = append(attrs, slog.Int("line", r.Start.Line))
+	}
+	if r.Start.Col > 0 {
+		attrs = append(attrs, slog.Int("col", r.Start.Col))
+	}
+	if r.Start.Offset > 0 || r.Start.Line <= 0 {
+		attrs = append(attrs, slog.Int("offset", r.Start.Offset))
+	}
+	if r.End.Line > 0 {
+		attrs = append(attrs, slog.Int("end_line", r.End.Line))
+	}
+	if r.End.Col > 0 {
+		attrs = append(attrs, slog.Int("end_col", r.End.Col))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// At attaches the source position an error refers to, such as the offending
+// token of a parse error, as "position" metadata. Positions show up in logs
+// and %+v, and Snippet renders them with the source they point into. Errors
+// at several positions can be combined with Join.
+// If err is a standard error, it wraps it to attach the position.
+func At(err error, pos Position) error {
+	return AtRange(err, Range{Start: pos})
+}
+
+// AtRange is like At for a range of source.
+func AtRange(err error, r Range) error {
+	if err == nil {
+		return nil
+	}
+	z, ok := err.(*Error)
+	if !ok {
+		// Upgrade standard error to zerr.Error safely
+		z = &Error{cause: err}
+	}
+	return z.with(positionKey, r)
+}
+
+// At attaches the source position the error refers to as metadata.
+func (e *Error) At(pos Position) *Error {
+	return e.with(positionKey, Range{Start: pos})
+}
+
+// AtRange attaches the range of source the error refers to as metadata.
+func (e *Error) AtRange(r Range) *Error {
+	return e.with(positionKey, r)
+}
+
+// positioned is an error carrying a source position.
+type positioned struct {
+	pos Range
+	err error
+}
+
+// positions returns the positioned layers of the error tree, including the
+// errors combined by Join, in depth-first order.
+func positions(err error) []positioned {
+	var found []positioned
+	for e := range layers(err) {
+		if z, ok := e.(*Error); ok {
+			for i := len(z.metadata) - 1; i >= 0; i-- {
+				if r, ok := z.metadata[i].value.(Range); ok && z.metadata[i].key.Value() == positionKey {
+					found = append(found, positioned{pos: r, err: e})
+					break
+				}
+			}
+		}
+	}
+	return found
+}
+
+// Positions returns the source ranges attached with At or AtRange anywhere in
+// the error tree, including the errors combined by Join, in depth-first order.
+func Positions(err error) []Range {
+	found := positions(err)
+	if len(found) == 0 {
+		return nil
+	}
+	ranges := make([]Range, len(found))
+	for i, p := range found {
+		ranges[i] = p.pos
+	}
+	return ranges
+}
+
+// SnippetOptions are options for Snippet.
+type SnippetOptions struct {
+	// Source returns the content of the named file, or nil if it is not
+	// available. A nil Source renders positions without source lines.
+	Source func(file string) []byte
+}
+
+// Snippet writes the errors of err that carry a source position to w, each
+// as "file:line:col: message" followed by the offending source line with the
+// position underlined by carets, in the style of compiler diagnostics:
+//
+//	config.yaml:3:1: unknown key "prot"
+//	  |
+//	3 | prot: 8080
+//	  | ^^^^
+//
+// Positions with an Offset but no Line are located using the source. Errors
+// without any position are written as a single line. If opts is nil, the
+// default options are used. If err is nil, Snippet writes nothing.
+func Snippet(w io.Writer, err error, opts *SnippetOptions) {
+	if err == nil {
+		return
+	}
+	if opts == nil {
+		opts = &SnippetOptions{}
+	}
+
+	found := positions(err)
+	if len(found) == 0 {
+		fmt.Fprintln(w, err.Error())
+		return
+	}
+
+	var sb strings.Builder
+	for i, p := range found {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+
+		var src []byte
+		if opts.Source != nil {
+			src = opts.Source(p.pos.Start.File)
+		}
+		r := Range{Start: locate(p.pos.Start, src), End: p.pos.End}
+		if r.End != (Position{}) {
+			r.End = locate(r.End, src)
+		}
+		fmt.Fprintf(&sb, "%s: %s\n", r.Start, p.err.Error())
+		writeSnippet(&sb, r, src)
+	}
+	io.WriteString(w, sb.String())
+}
+
+// locate fills in the line and column of pos from its offset in src if its
+// line is unknown.
+func locate(pos Position, src []byte) Position {
+	if pos.Line > 0 || src == nil || pos.Offset < 0 || pos.Offset > len(src) {
+		return pos
+	}
+	before := src[:pos.Offset]
+	pos.Line = bytes.Count(before, []byte("\n")) + 1
+	pos.Col = pos.Offset - (bytes.LastIndexByte(before, '\n') + 1) + 1
+	return pos
+}
+
+// writeSnippet writes the source line of r from src with the range
+// underlined. Ranges spanning several lines are underlined up to the end of
+// their first line. Nothing is written if the line is not in src.
+func writeSnippet(sb *strings.Builder, r Range, src []byte) {
+	if len(src) == 0 {
+		return
+	}
+	lines := strings.Split(string(src), "\n")
+	if r.Start.Line < 1 || r.Start.Line > len(lines) {
+		return
+	}
+	line := strings.TrimRight(lines[r.Start.Line-1], "\r")
+
+	gutter := strings.Repeat(" ", len(strconv.Itoa(r.Start.Line)))
+	fmt.Fprintf(sb, "%s |\n%d | %s\n%s | ", gutter, r.Start.Line, line, gutter)
+	if r.Start.Col < 1 {
+		sb.WriteByte('\n')
+		return
+	}
+
+	// Pad with a space per character, keeping tabs, so that the carets line
+	// up under multi-byte characters and tabs
+	start := min(r.Start.Col-1, len(line))
+	for _, c := range line[:start] {
+		if c == '\t' {
+			sb.WriteByte('\t')
+		} else {
+			sb.WriteByte(' ')
+		}
+	}
+
+	width := 1
+	switch {
+	case r.End.Line == r.Start.Line && r.End.Col > r.Start.Col:
+		end := min(r.End.Col-1, len(line))
+		width = max(utf8.RuneCountInString(line[start:end]), 1)
+	case r.End.Line > r.Start.Line:
+		width = max(utf8.RuneCountInString(line[start:]), 1)
+	}
+	sb.WriteString(strings.Repeat("^", width))
+	sb.WriteByte('\n')
+}
@@ -0,0 +1,245 @@
+// Package zerr provides an error occurrence profiler.
+package zerr
+
+import (
+	"cmp"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errorProfile counts error creations per capture site.
+type errorProfile struct {
+	start  time.Time
+	end    atomic.Int64 // Unix nanoseconds at which profiling stopped, zero while running
+	counts sync.Map     // map[*stackCacheEntry]*atomic.Int64
+}
+
+var (
+	// activeProfile is the profile being recorded, nil if profiling is off.
+	activeProfile atomic.Pointer[errorProfile]
+	// lastProfile is the most recently started profile, running or stopped.
+	lastProfile atomic.Pointer[errorProfile]
+)
+
+// StartProfile starts counting the errors created by New and Wrap, including
+// those of a Factory, per capture site. Each creation captures the stack of
+// its caller, which is deduplicated with the stacks attached to errors, so
+// profiling costs about as much as capturing stacks everywhere.
+// Starting a profile discards the counts of the previous one.
+func StartProfile() {
+	p := &errorProfile{start: time.Now()}
+	lastProfile.Store(p)
+	activeProfile.Store(p)
+	updateHooks()
+}
+
+// StopProfile stops counting errors. The counts are kept until the next
+// StartProfile and can still be written.
+func StopProfile() {
+	if p := activeProfile.Swap(nil); p != nil {
+		p.end.Store(time.Now().UnixNano())
+	}
+	updateHooks()
+}
+
+// add counts an error created at stack.
+func (p *errorProfile) add(stack *stackCacheEntry) {
+	counter, ok := p.counts.Load(stack)
+	if !ok {
+		counter, _ = p.counts.LoadOrStore(stack, new(atomic.Int64))
+	}
+	counter.(*atomic.Int64).Add(1)
+}
+
+// profileSample is the number of errors created at a stack.
+type profileSample struct {
+	stack *stackCacheEntry
+	count int64
+}
+
+// samples returns the counts of the profile, most frequent first.
+func (p *errorProfile) samples() []profileSample {
+	var samples []profileSample
+	p.counts.Range(func(key, value any) bool {
+		stack := key.(*stackCacheEntry)
+		stack.resolve()
+		samples = append(samples, profileSample{stack: stack, count: value.(*atomic.Int64).Load()})
+		return true
+	})
+	slices.SortFunc(samples, func(a, b profileSample) int {
+		if c := cmp.Compare(b.count, a.count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.stack.formatted, b.stack.formatted)
+	})
+	return samples
+}
+
+// duration returns how long the profile has been or was recorded.
+func (p *errorProfile) duration() time.Duration {
+	if end := p.end.Load(); end != 0 {
+		return time.Unix(0, end).Sub(p.start)
+	}
+	return time.Since(p.start)
+}
+
+// errNoProfile is returned when writing a profile before StartProfile.
+var errNoProfile = errors.New("zerr: no error profile has been started")
+
+// WriteProfile writes the current or last error profile to w as a gzipped
+// pprof profile.proto, with one "errors" sample per distinct creation stack:
+//
+//	go tool pprof -top errors.pb.gz
+func WriteProfile(w io.Writer) error {
+	p := lastProfile.Load()
+	if p == nil {
+		return errNoProfile
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(p.encode()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// encode returns the profile in the pprof profile.proto format.
+func (p *errorProfile) encode() []byte {
+	var (
+		b         protobuf
+		table     = []string{""}
+		stringIDs = map[string]int64{"": 0}
+		locations = map[Frame]uint64{}
+		functions = map[Frame]uint64{} // Keyed by function and file only
+		locBuf    protobuf
+		funcBuf   protobuf
+	)
+
+	str := func(s string) int64 {
+		id, ok := stringIDs[s]
+		if !ok {
+			id = int64(len(table))
+			stringIDs[s] = id
+			table = append(table, s)
+		}
+		return id
+	}
+	valueType := func(tag int, typ, unit string) {
+		b.message(tag, func(m *protobuf) {
+			m.int64(1, str(typ))
+			m.int64(2, str(unit))
+		})
+	}
+	function := func(frame Frame) uint64 {
+		key := Frame{Function: frame.Function, File: frame.File}
+		id, ok := functions[key]
+		if !ok {
+			id = uint64(len(functions) + 1)
+			functions[key] = id
+			funcBuf.message(5, func(m *protobuf) {
+				m.uint64(1, id)
+				m.int64(2, str(frame.Function))
+				m.int64(3, str(frame.Function))
+				m.int64(4, str(frame.File))
+			})
+		}
+		return id
+	}
+	location := func(frame Frame) uint64 {
+		id, ok := locations[frame]
+		if !ok {
+			id = uint64(len(locations) + 1)
+			locations[frame] = id
+			fn := function(frame)
+			locBuf.message(4, func(m *protobuf) {
+				m.uint64(1, id)
+				m.message(4, func(line *protobuf) {
+					line.uint64(1, fn)
+					line.int64(2, int64(frame.Line))
+				})
+			})
+		}
+		return id
+	}
+
+	valueType(1, "errors", "count")
+	for _, s := range p.samples() {
+		ids := make([]uint64, len(s.stack.frames))
+		for i, frame := range s.stack.frames {
+			ids[i] = location(frame)
+		}
+		b.message(2, func(m *protobuf) {
+			m.uint64s(1, ids)
+			m.uint64s(2, []uint64{uint64(s.count)})
+		})
+	}
+	b.data = append(b.data, locBuf.data...)
+	b.data = append(b.data, funcBuf.data...)
+	b.int64(9, p.start.UnixNano())
+	b.int64(10, int64(p.duration()))
+	valueType(11, "errors", "count")
+	b.int64(12, 1)
+
+	for _, s := range table {
+		b.string(6, s)
+	}
+	return b.data
+}
+
+// WriteProfileTop writes a text report of the n capture sites that created
+// the most errors in the current or last error profile to w. Errors are
+// attributed to the top frame of their creation stack; n <= 0 reports every
+// site.
+func WriteProfileTop(w io.Writer, n int) error {
+	p := lastProfile.Load()
+	if p == nil {
+		return errNoProfile
+	}
+
+	type site struct {
+		frame Frame
+		count int64
+	}
+	var (
+		sites []site
+		index = map[Frame]int{}
+		total int64
+	)
+	for _, s := range p.samples() {
+		if len(s.stack.frames) == 0 {
+			continue
+		}
+		frame := s.stack.frames[0]
+		i, ok := index[frame]
+		if !ok {
+			i = len(sites)
+			index[frame] = i
+			sites = append(sites, site{frame: frame})
+		}
+		sites[i].count += s.count
+		total += s.count
+	}
+	slices.SortStableFunc(sites, func(a, b site) int {
+		return cmp.Compare(b.count, a.count)
+	})
+	if n > 0 && n < len(sites) {
+		sites = sites[:n]
+	}
+
+	if _, err := fmt.Fprintf(w, "%d errors at %d sites in %s\n", total, len(index), p.duration().Round(time.Millisecond)); err != nil {
+		return err
+	}
+	for _, s := range sites {
+		percent := 100 * float64(s.count) / float64(total)
+		if _, err := fmt.Fprintf(w, "%8d %6.2f%%  %s\n", s.count, percent, formatFrame(s.frame)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
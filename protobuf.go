@@ -0,0 +1,76 @@
+// Package zerr provides a minimal protocol buffer encoder for profiles.
+package zerr
+
+// protobuf is an append-only protocol buffer encoder, sufficient to write
+// the messages of the pprof profile format without external dependencies.
+type protobuf struct {
+	data []byte
+}
+
+// Protocol buffer wire types.
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// varint appends x in base 128 varint encoding.
+func (b *protobuf) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+// key appends the key of field tag with the given wire type.
+func (b *protobuf) key(tag int, wire int) {
+	b.varint(uint64(tag)<<3 | uint64(wire))
+}
+
+// uint64 appends a varint field, omitting zero values.
+func (b *protobuf) uint64(tag int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.key(tag, wireVarint)
+	b.varint(x)
+}
+
+// int64 appends a varint field, omitting zero values.
+func (b *protobuf) int64(tag int, x int64) {
+	b.uint64(tag, uint64(x))
+}
+
+// uint64s appends a packed repeated varint field.
+func (b *protobuf) uint64s(tag int, xs []uint64) {
+	if len(xs) == 0 {
+		return
+	}
+	var packed protobuf
+	for _, x := range xs {
+		packed.varint(x)
+	}
+	b.bytes(tag, packed.data)
+}
+
+// string appends a length-delimited string field. Unlike scalars, strings
+// are always written since the string table relies on their positions.
+func (b *protobuf) string(tag int, s string) {
+	b.key(tag, wireBytes)
+	b.varint(uint64(len(s)))
+	b.data = append(b.data, s...)
+}
+
+// bytes appends a length-delimited field, such as an embedded message.
+func (b *protobuf) bytes(tag int, data []byte) {
+	b.key(tag, wireBytes)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+// message appends an embedded message built by fn.
+func (b *protobuf) message(tag int, fn func(*protobuf)) {
+	var m protobuf
+	fn(&m)
+	b.bytes(tag, m.data)
+}
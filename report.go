@@ -0,0 +1,179 @@
+// Package zerr provides a human-friendly error reporter for command line tools.
+package zerr
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ColorMode selects whether Report uses ANSI colors.
+type ColorMode uint8
+
+const (
+	// ColorAuto uses colors when writing to a terminal and the NO_COLOR
+	// environment variable is not set.
+	ColorAuto ColorMode = iota
+	// ColorAlways always uses colors.
+	ColorAlways
+	// ColorNever never uses colors.
+	ColorNever
+)
+
+// ReportOptions are options for Report.
+type ReportOptions struct {
+	// Color selects whether ANSI colors are used. The zero value is ColorAuto.
+	Color ColorMode
+	// Stack includes the stack trace captured deepest in the chain.
+	Stack bool
+}
+
+// ANSI escape sequences used by Report.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// Report writes a multi-line report of err for the users of a command line
+// tool to w: a headline with the outermost message and code, a "Caused by:"
+// list with the message of each further layer of the chain, or of every layer
+// of the errors combined by Join, a table of the metadata merged across all
+// layers, the hints and documentation links accumulated across all layers and,
+// if requested, the stack trace.
+// If opts is nil, the default options are used. If err is nil, Report writes
+// nothing.
+//
+//	Error [DB]: create user
+//
+//	Caused by:
+//	   0: insert row
+//	   1: db timeout
+//
+//	Metadata:
+//	   table  users
+//
+//	Help:
+//	   run `migrate up` first
+//	   See https://example.com/docs/migrations
+func Report(w io.Writer, err error, opts *ReportOptions) {
+	if err == nil {
+		return
+	}
+	if opts == nil {
+		opts = &ReportOptions{}
+	}
+
+	r := reporter{color: useColor(w, opts.Color)}
+	f := flatten(err)
+
+	headline := f.message
+	causes := []string(nil)
+	switch {
+	case f.joined:
+		causes = f.chain
+	case len(f.chain) > 0:
+		headline, causes = f.chain[0], f.chain[1:]
+	}
+	r.write(ansiBold+ansiRed, "Error")
+	if f.code != "" {
+		r.write(ansiBold+ansiRed, " ["+f.code+"]")
+	}
+	r.write(ansiBold, ": "+headline)
+	r.sb.WriteByte('\n')
+
+	if len(causes) > 0 {
+		r.section("Caused by:")
+		width := len(fmt.Sprint(len(causes) - 1))
+		for i, cause := range causes {
+			r.sb.WriteString("   ")
+			r.write(ansiYellow, fmt.Sprintf("%*d:", width, i))
+			r.sb.WriteString(" " + cause + "\n")
+		}
+	}
+
+	if len(f.meta) > 0 {
+		r.section("Metadata:")
+		width := 0
+		for _, a := range f.meta {
+			width = max(width, len(a.Key))
+		}
+		for _, a := range f.meta {
+			r.sb.WriteString("   ")
+			r.write(ansiCyan, fmt.Sprintf("%-*s", width, a.Key))
+			r.sb.WriteString("  " + a.Value.Resolve().String() + "\n")
+		}
+	}
+
+	if len(f.hints) > 0 || len(f.urls) > 0 {
+		r.section("Help:")
+		for _, hint := range f.hints {
+			r.sb.WriteString("   " + hint + "\n")
+		}
+		for _, url := range f.urls {
+			r.sb.WriteString("   See ")
+			r.write(ansiCyan, url)
+			r.sb.WriteByte('\n')
+		}
+	}
+
+	if opts.Stack && f.stack != nil {
+		r.section("Stack:")
+		f.stack.resolve()
+		for _, frame := range f.stack.frames {
+			r.sb.WriteString("   ")
+			r.write(ansiDim, formatFrame(frame))
+			r.sb.WriteByte('\n')
+		}
+	}
+
+	io.WriteString(w, r.sb.String())
+}
+
+// reporter builds the output of Report.
+type reporter struct {
+	sb    strings.Builder
+	color bool
+}
+
+// write writes s in the given style if colors are enabled.
+func (r *reporter) write(style, s string) {
+	if !r.color {
+		r.sb.WriteString(s)
+		return
+	}
+	r.sb.WriteString(style)
+	r.sb.WriteString(s)
+	r.sb.WriteString(ansiReset)
+}
+
+// section starts a new section with the given title.
+func (r *reporter) section(title string) {
+	r.sb.WriteByte('\n')
+	r.write(ansiBold, title)
+	r.sb.WriteByte('\n')
+}
+
+// useColor reports whether Report uses colors for w in the given mode.
+func useColor(w io.Writer, mode ColorMode) bool {
+	switch mode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
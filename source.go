@@ -0,0 +1,153 @@
+// Package zerr provides source code context for developer stack output.
+package zerr
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultDevContext is the number of source lines shown around each frame
+// by Dev when no source context is set globally.
+const defaultDevContext = 2
+
+// sourceContext holds the global number of source lines shown around each
+// frame by %+v, zero if disabled.
+var sourceContext atomic.Int32
+
+// SetSourceContext makes %+v show lines of source code before and after the
+// line of each stack frame and return trace location, with the line itself
+// highlighted. Sources are read from disk on first use and cached per file;
+// frames whose file cannot be read, for example in binaries built with
+// -trimpath or deployed without sources, are printed without context.
+// It is intended for local development. Zero, the default, disables it.
+func SetSourceContext(lines int) {
+	sourceContext.Store(int32(max(lines, 0)))
+}
+
+// sourceFile holds the lines of a source file, nil if it cannot be read.
+type sourceFile struct {
+	once  sync.Once
+	lines []string
+}
+
+// sourceCache maps file paths to their *sourceFile.
+var sourceCache sync.Map
+
+// sourceLines returns the lines of the file at path, or nil if it cannot be read.
+func sourceLines(path string) []string {
+	f, ok := sourceCache.Load(path)
+	if !ok {
+		f, _ = sourceCache.LoadOrStore(path, new(sourceFile))
+	}
+
+	src := f.(*sourceFile)
+	src.once.Do(func() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return
+		}
+		src.lines = strings.Split(string(bytes.TrimSuffix(data, []byte("\n"))), "\n")
+	})
+	return src.lines
+}
+
+// writeSource writes context lines of source around frame to w, marking the
+// line of the frame with '>'. Nothing is written if the source is unavailable.
+func writeSource(w io.Writer, frame Frame, context int) {
+	lines := sourceLines(frame.File)
+	if frame.Line < 1 || frame.Line > len(lines) {
+		return
+	}
+
+	first := max(frame.Line-context, 1)
+	last := min(frame.Line+context, len(lines))
+	width := len(fmt.Sprint(last))
+	for n := first; n <= last; n++ {
+		marker := " "
+		if n == frame.Line {
+			marker = ">"
+		}
+		line := strings.TrimRight(lines[n-1], "\r")
+		fmt.Fprintf(w, "\n    %s %*d | %s", marker, width, n, line)
+	}
+}
+
+// writeVerbose writes the message of err followed by its hints, documentation
+// links, source positions, return trace and the frames of stack, each code
+// location with context lines of source if context is positive.
+func writeVerbose(w io.Writer, err error, stack *stackCacheEntry, context int) {
+	io.WriteString(w, err.Error())
+	hints, urls := collectHelp(err)
+	for _, hint := range hints {
+		io.WriteString(w, "\nhint: "+hint)
+	}
+	for _, url := range urls {
+		io.WriteString(w, "\nsee: "+url)
+	}
+	for _, p := range positions(err) {
+		io.WriteString(w, "\nposition: "+p.pos.String())
+	}
+	for _, pc := range returnTracePCs(err) {
+		frame := resolveCaller(pc)
+		io.WriteString(w, "\nat "+formatFrame(frame))
+		if context > 0 {
+			writeSource(w, frame, context)
+		}
+	}
+
+	if stack == nil {
+		return
+	}
+	stack.resolve()
+	if context <= 0 {
+		io.WriteString(w, stack.formatted)
+		return
+	}
+	for _, frame := range stack.frames {
+		io.WriteString(w, "\n"+formatFrame(frame))
+		writeSource(w, frame, context)
+	}
+}
+
+// Dev returns err wrapped so that %v and %+v render it for a developer: the
+// message, the return trace and the stack captured deepest in the chain, each
+// location followed by its source code, like a Python traceback. Context
+// lines follow SetSourceContext, or default to two. The result still behaves
+// as err for errors.Is, errors.As and Error. If err is nil, Dev returns nil.
+func Dev(err error) error {
+	if err == nil {
+		return nil
+	}
+	return devError{err}
+}
+
+// devError is an error that formats for developers.
+type devError struct {
+	error
+}
+
+// Unwrap implements the unwrap interface for error chaining.
+func (d devError) Unwrap() error {
+	return d.error
+}
+
+// Format implements the fmt.Formatter interface.
+func (d devError) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		context := int(sourceContext.Load())
+		if context == 0 {
+			context = defaultDevContext
+		}
+		writeVerbose(s, d.error, deepestStack(d.error), context)
+	case 's':
+		fmt.Fprint(s, d.Error())
+	case 'q':
+		fmt.Fprintf(s, "%q", d.Error())
+	}
+}
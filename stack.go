@@ -2,8 +2,10 @@
 package zerr
 
 import (
+	"encoding/json"
 	"fmt"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"weak"
@@ -21,8 +23,19 @@ var (
 func getOrCreateStack(skip int) *stackCacheEntry {
 	// Get a pc slice from the pool
 	pcsPtr := pcPool.Get().(*[]uintptr)
-	pcs := *pcsPtr
+	pcs := callers(skip+1, *pcsPtr)
 
+	entry := internStack(pcs[helperFrames(pcs):])
+
+	*pcsPtr = pcs
+	pcPool.Put(pcsPtr)
+
+	return entry
+}
+
+// callers captures the program counters of the current goroutine into pcs,
+// growing it if the stack does not fit.
+func callers(skip int, pcs []uintptr) []uintptr {
 	// Reset length to capacity to ensure we can capture the full stack trace
 	pcs = pcs[:cap(pcs)]
 
@@ -36,8 +49,12 @@ func getOrCreateStack(skip int) *stackCacheEntry {
 	}
 
 	// Trim to actual size
-	pcs = pcs[:n]
+	return pcs[:n]
+}
 
+// internStack returns the cached entry for pcs, creating it if needed.
+// The pcs slice is copied, so the caller may reuse it.
+func internStack(pcs []uintptr) *stackCacheEntry {
 	// Create a hash of the pcs for caching using a non-commutative algorithm
 	var hash uintptr = 17
 	for _, pc := range pcs {
@@ -58,8 +75,6 @@ func getOrCreateStack(skip int) *stackCacheEntry {
 				// Verify that the cached PCs actually match the current PCs
 				if stackMatches(ptr.pc, pcs) {
 					// Found it!
-					*pcsPtr = pcs
-					pcPool.Put(pcsPtr)
 					return ptr
 				}
 			}
@@ -103,9 +118,6 @@ func getOrCreateStack(skip int) *stackCacheEntry {
 		// Someone else inserted it while we waited for lock
 		stackCacheMu.Unlock()
 
-		*pcsPtr = pcs
-		pcPool.Put(pcsPtr)
-
 		return foundEntry
 	}
 
@@ -113,13 +125,49 @@ func getOrCreateStack(skip int) *stackCacheEntry {
 	stackCache[hash] = append(stackCache[hash], weak.Make(newEntry))
 	stackCacheMu.Unlock()
 
-	// ---------------------------------------------------------
-	// 3. RETURN
-	// ---------------------------------------------------------
+	return newEntry
+}
+
+// panicStack captures the stack of a panicking goroutine from within a
+// deferred call. The frames of the deferred call and of the runtime panic
+// machinery are trimmed so that the first frame is the one that panicked.
+// If no panic is in progress, the stack is captured from skip instead.
+func panicStack(skip int) *stackCacheEntry {
+	pcsPtr := pcPool.Get().(*[]uintptr)
+	pcs := callers(skip+1, *pcsPtr)
+
+	entry := internStack(pcs[panicFrames(pcs):])
+
 	*pcsPtr = pcs
 	pcPool.Put(pcsPtr)
 
-	return newEntry
+	return entry
+}
+
+// panicFrames returns the number of leading frames of pcs that belong to
+// deferred calls and to the runtime panic machinery, or 0 if pcs was not
+// captured during a panic.
+func panicFrames(pcs []uintptr) int {
+	for i, pc := range pcs {
+		if funcName(pc) != "runtime.gopanic" {
+			continue
+		}
+		// Skip runtime frames raising the panic, e.g. runtime.panicmem or runtime.sigpanic
+		i++
+		for i < len(pcs) && strings.HasPrefix(funcName(pcs[i]), "runtime.") {
+			i++
+		}
+		return i
+	}
+	return 0
+}
+
+// funcName returns the name of the function containing the return address pc.
+func funcName(pc uintptr) string {
+	if fn := runtime.FuncForPC(pc - 1); fn != nil {
+		return fn.Name()
+	}
+	return ""
 }
 
 // stackMatches checks if two PC slices are identical.
@@ -135,27 +183,95 @@ func stackMatches(cached []uintptr, current []uintptr) bool {
 	return true
 }
 
-// formatStackTrace converts a stack trace to a human-readable string.
-// Operation is deferred until the stack trace is actually needed.
-func formatStackTrace(pc []uintptr) string {
+// Frame is a single resolved frame of a captured stack trace.
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// resolve symbolizes the captured program counters on first use and caches
+// both the structured frames and the formatted string.
+func (s *stackCacheEntry) resolve() {
+	s.once.Do(func() {
+		s.frames = resolveFrames(s.pc)
+		s.formatted = formatFrames(s.frames)
+	})
+}
+
+// resolveFrames converts program counters into frames.
+func resolveFrames(pc []uintptr) []Frame {
 	if len(pc) == 0 {
-		return ""
+		return nil
 	}
 
-	var sb strings.Builder
+	result := make([]Frame, 0, len(pc))
 	frames := runtime.CallersFrames(pc)
 
 	for {
 		frame, more := frames.Next()
-		fmt.Fprintf(&sb, "\n%s:%d %s", frame.File, frame.Line, frame.Function)
+		result = append(result, Frame{
+			Function: frame.Function,
+			File:     frame.File,
+			Line:     frame.Line,
+		})
 		if !more {
 			break
 		}
 	}
 
+	return trimHelpers(result)
+}
+
+// formatFrames converts resolved frames to a human-readable string.
+func formatFrames(frames []Frame) string {
+	var sb strings.Builder
+	for _, frame := range frames {
+		sb.WriteByte('\n')
+		sb.WriteString(formatFrame(frame))
+	}
 	return sb.String()
 }
 
+// formatFrame converts a resolved frame to a human-readable string.
+func formatFrame(frame Frame) string {
+	return fmt.Sprintf("%s:%d %s", frame.File, frame.Line, frame.Function)
+}
+
+// callerPC returns the program counter of the caller of the function calling
+// callerPC, skipping skip additional frames.
+// Frames of functions marked by Helper are skipped.
+func callerPC(skip int) uintptr {
+	if hasHelpers.Load() {
+		var pcs [32]uintptr
+		n := runtime.Callers(skip+3, pcs[:])
+		if n == 0 {
+			return 0
+		}
+		return pcs[min(helperFrames(pcs[:n]), n-1)]
+	}
+
+	var pc [1]uintptr
+	runtime.Callers(skip+3, pc[:]) // Skip runtime.Callers, callerPC, and its caller
+	return pc[0]
+}
+
+// resolveCaller converts a program counter captured by callerPC into a frame,
+// skipping frames of helpers inlined into the caller.
+func resolveCaller(pc uintptr) Frame {
+	frames := runtime.CallersFrames([]uintptr{pc})
+	for {
+		frame, more := frames.Next()
+		if !more || !hasHelpers.Load() || !isHelper(frame.Function) {
+			return Frame{
+				Function: frame.Function,
+				File:     frame.File,
+				Line:     frame.Line,
+			}
+		}
+	}
+}
+
 // StackTrace returns a formatted stack trace string.
 // Uses lazy formatting - the stack trace is only formatted when this method is called.
 func (e *Error) StackTrace() string {
@@ -164,9 +280,146 @@ func (e *Error) StackTrace() string {
 	}
 
 	// Format on first access and cache the result
-	e.stack.once.Do(func() {
-		e.stack.formatted = formatStackTrace(e.stack.pc)
-	})
+	e.stack.resolve()
 
 	return e.stack.formatted
 }
+
+// StackOf returns the formatted stack trace captured deepest in the error
+// chain, which is the one closest to the origin of the error, or "" if no
+// layer carries a stack trace. Unlike StackTrace, it looks past the receiver.
+func StackOf(err error) string {
+	stack := deepestStack(err)
+	if stack == nil {
+		return ""
+	}
+	stack.resolve()
+	return stack.formatted
+}
+
+// deepestStack returns the stack captured deepest in the error tree, the first
+// one in depth-first order among errors combined by Join at the same depth.
+func deepestStack(err error) *stackCacheEntry {
+	var stack *stackCacheEntry
+	stackDepth := -1
+	walk(err, func(err error, depth int) bool {
+		if zerr, ok := err.(*Error); ok && zerr.stack != nil && depth > stackDepth {
+			stack, stackDepth = zerr.stack, depth
+		}
+		return true
+	})
+	return stack
+}
+
+// stackValue is the log representation of a captured stack trace.
+// Text handlers render it as the formatted string, JSON handlers as a list of frames.
+type stackValue struct {
+	entry *stackCacheEntry
+}
+
+// String implements fmt.Stringer.
+func (v stackValue) String() string {
+	v.entry.resolve()
+	return v.entry.formatted
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v stackValue) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v stackValue) MarshalJSON() ([]byte, error) {
+	v.entry.resolve()
+	return json.Marshal(v.entry.frames)
+}
+
+// ReturnTrace returns the locations recorded on the layers of the error chain
+// by WithCaller, WrapHere or return traces (see SetReturnTraces), ordered from
+// the origin of the error to its outermost wrapper. The locations of errors
+// combined by Join come first, each joined error origin first and in order.
+func ReturnTrace(err error) []Frame {
+	pcs := returnTracePCs(err)
+	if len(pcs) == 0 {
+		return nil
+	}
+	return resolveCallers(pcs)
+}
+
+// returnTracePCs returns the caller locations of the error tree, origin first.
+func returnTracePCs(err error) []uintptr {
+	return appendReturnTrace(nil, err, 0)
+}
+
+// appendReturnTrace appends the caller locations of the chain of err at the
+// given depth to pcs, origin first. Like walk, it descends into every error of
+// an Unwrap() []error method; their locations precede those of the layers
+// wrapping them.
+func appendReturnTrace(pcs []uintptr, err error, depth int) []uintptr {
+	var chain []uintptr
+	for ; err != nil && depth < maxDepth; depth++ {
+		if zerr, ok := err.(*Error); ok && zerr.caller != 0 {
+			chain = append(chain, zerr.caller)
+		}
+		if m, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range m.Unwrap() {
+				pcs = appendReturnTrace(pcs, e, depth+1)
+			}
+			break
+		}
+		err = unwrap(err)
+	}
+	slices.Reverse(chain)
+	return append(pcs, chain...)
+}
+
+// traceValue is the log representation of a return trace.
+// Text handlers render it like a stack trace, JSON handlers as a list of frames.
+type traceValue struct {
+	pcs []uintptr
+}
+
+// String implements fmt.Stringer.
+func (v traceValue) String() string {
+	return formatFrames(resolveCallers(v.pcs))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v traceValue) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v traceValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(resolveCallers(v.pcs))
+}
+
+// resolveCallers converts program counters captured by callerPC into frames.
+func resolveCallers(pcs []uintptr) []Frame {
+	frames := make([]Frame, len(pcs))
+	for i, pc := range pcs {
+		frames[i] = resolveCaller(pc)
+	}
+	return frames
+}
+
+// callerValue is the log representation of a caller location.
+// Text handlers render it as a string, JSON handlers as a frame object.
+type callerValue struct {
+	pc uintptr
+}
+
+// String implements fmt.Stringer.
+func (v callerValue) String() string {
+	return formatFrame(resolveCaller(v.pc))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v callerValue) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v callerValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(resolveCaller(v.pc))
+}
@@ -0,0 +1,27 @@
+// Package zerr provides helpers for safely calling untrusted functions.
+package zerr
+
+// Try calls fn and returns its error. A panic in fn is recovered and
+// converted into an error like in Defer, and an error returned by fn is
+// wrapped with the stack of the caller of Try, so the call site of a plugin or
+// user-supplied callback is always known.
+func Try(fn func() error) (err error) {
+	defer Recover(&err)
+
+	if err = fn(); err != nil {
+		return &Error{cause: err, stack: getOrCreateStack(2)}
+	}
+	return nil
+}
+
+// TryValue is like Try for functions that return a value. If fn fails or
+// panics, the zero value of T is returned along with the error.
+func TryValue[T any](fn func() (T, error)) (value T, err error) {
+	defer Recover(&err)
+
+	if value, err = fn(); err != nil {
+		var zero T
+		return zero, &Error{cause: err, stack: getOrCreateStack(2)}
+	}
+	return value, nil
+}
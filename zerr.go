@@ -4,8 +4,9 @@ package zerr
 
 import (
 	"fmt"
-	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"unique"
 )
 
@@ -14,7 +15,41 @@ type Error struct {
 	message  string
 	cause    error
 	stack    *stackCacheEntry
+	caller   uintptr
 	metadata []metaPair
+	ext      *errorExt
+}
+
+// errorExt holds the rarely set fields of an Error. It is allocated only when
+// one of them is set, which keeps New and Wrap small, and it is never modified
+// once attached to an error.
+type errorExt struct {
+	code   string
+	logged bool
+	panic  *panicInfo
+	hints  []string
+	url    string
+}
+
+// noExt is the extension of errors without one.
+var noExt errorExt
+
+// extension returns the extension of e for reading.
+func (e *Error) extension() *errorExt {
+	if e.ext == nil {
+		return &noExt
+	}
+	return e.ext
+}
+
+// extend returns a copy of e with its own extension that can be modified.
+func (e *Error) extend() *Error {
+	newErr := e.clone()
+	newErr.ext = new(errorExt)
+	if e.ext != nil {
+		*newErr.ext = *e.ext
+	}
+	return newErr
 }
 
 // metaPair holds a key-value pair for metadata.
@@ -26,6 +61,7 @@ type metaPair struct {
 // stackCacheEntry holds a cached stack trace.
 type stackCacheEntry struct {
 	pc        []uintptr
+	frames    []Frame
 	formatted string
 	once      sync.Once
 }
@@ -39,32 +75,70 @@ var pcPool = sync.Pool{
 	},
 }
 
+// returnTraces reports whether New, Wrap and With record their call sites.
+var returnTraces atomic.Bool
+
+// SetReturnTraces enables or disables error return traces. When enabled, New,
+// Wrap and With record their call site on the layer they create, like
+// WithCaller, so that walking the chain yields the path an error took through
+// the code even when it has no stack trace; see ReturnTrace. With only records
+// a call site on layers that do not have one yet. Disabled by default.
+func SetReturnTraces(enabled bool) {
+	returnTraces.Store(enabled)
+	updateHooks()
+}
+
 // New creates a new error with the given message.
 func New(message string) error {
+	if atomic.LoadUint32(&hooks.bits) != 0 {
+		return newSlow(message)
+	}
 	return &Error{
 		message: message,
 	}
 }
 
+// newSlow implements New when a hook is enabled. It is kept out of line so
+// that New stays inlinable, which lets the compiler keep errors that do not
+// escape on the stack.
+//
+//go:noinline
+func newSlow(message string) error {
+	newErr := &Error{
+		message: message,
+	}
+	instrument(newErr, globalPolicy.Load(), captureNew, 1)
+	return newErr
+}
+
 // Wrap wraps an existing error with an additional message.
 // If err is nil, Wrap returns nil.
 func Wrap(err error, message string) error {
-	if err == nil {
-		return nil
+	// A single branch for both slow cases keeps Wrap inlinable
+	if err == nil || atomic.LoadUint32(&hooks.bits) != 0 {
+		return wrapSlow(err, message)
+	}
+	return &Error{
+		message: message,
+		cause:   err,
 	}
+}
 
-	// Try to cast to our error type first
-	if zerr, ok := err.(*Error); ok {
-		return &Error{
-			message: message,
-			cause:   zerr,
-		}
+// wrapSlow implements Wrap when err is nil or a hook is enabled. It is kept
+// out of line so that Wrap stays inlinable.
+//
+//go:noinline
+func wrapSlow(err error, message string) error {
+	if err == nil {
+		return nil
 	}
 
-	return &Error{
+	newErr := &Error{
 		message: message,
 		cause:   err,
 	}
+	instrument(newErr, globalPolicy.Load(), wrapCapture(err), 1)
+	return newErr
 }
 
 // With attaches a key-value pair to an error.
@@ -74,44 +148,187 @@ func With(err error, key string, value any) error {
 	if err == nil {
 		return nil
 	}
-	if z, ok := err.(*Error); ok {
-		return z.With(key, value)
+	z, ok := err.(*Error)
+	if !ok {
+		// Upgrade standard error to zerr.Error safely
+		z = &Error{cause: err}
 	}
-	// Upgrade standard error to zerr.Error safely
-	wrapped := Wrap(err, "")
-	if z, ok := wrapped.(*Error); ok {
-		return z.With(key, value)
+
+	newErr := z.with(key, value)
+	if newErr.caller == 0 && returnTraces.Load() {
+		newErr.caller = callerPC(0)
+	}
+	return newErr
+}
+
+// Join returns an error that wraps the given errors, discarding nil errors.
+// If every error is nil, Join returns nil. The result matches each of the
+// joined errors with errors.Is and errors.As.
+func Join(errs ...error) error {
+	n := 0
+	for _, err := range errs {
+		if err != nil {
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+
+	joined := make([]error, 0, n)
+	for _, err := range errs {
+		if err != nil {
+			joined = append(joined, err)
+		}
+	}
+	return &Error{
+		cause: &multiError{errs: joined},
 	}
-	return wrapped
+}
+
+// multiError holds the errors combined by Join.
+type multiError struct {
+	errs []error
+}
+
+// Error implements the error interface.
+func (m *multiError) Error() string {
+	if len(m.errs) == 1 {
+		return m.errs[0].Error()
+	}
+
+	var sb strings.Builder
+	for i, err := range m.errs {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(err.Error())
+	}
+	return sb.String()
+}
+
+// Unwrap implements the multi-error unwrap interface.
+func (m *multiError) Unwrap() []error {
+	return m.errs
 }
 
 // Stack captures the stack trace for the error.
 // If err is already a *Error, it attaches the stack trace directly.
 // If err is a standard error, it wraps it to capture the stack trace.
 func WithStack(err error) error {
+	if err == nil {
+		return nil
+	}
+	z, ok := err.(*Error)
+	if !ok {
+		// Upgrade standard error to zerr.Error safely
+		z = &Error{cause: err}
+	}
+	// Capture here rather than in the method so that the stack starts at the caller
+	newErr := z.clone()
+	newErr.stack = getOrCreateStack(2)
+	return newErr
+}
+
+// WithStackIfMissing captures a stack trace for the error unless the error
+// chain already carries one, in which case err is returned unchanged.
+// If err is a standard error without a stack, it wraps it to capture the stack trace.
+func WithStackIfMissing(err error) error {
+	if err == nil {
+		return nil
+	}
+	if deepestStack(err) != nil {
+		return err
+	}
+
+	z, ok := err.(*Error)
+	if !ok {
+		// Upgrade standard error to zerr.Error safely
+		z = &Error{cause: err}
+	}
+	newErr := z.clone()
+	newErr.stack = getOrCreateStack(2)
+	return newErr
+}
+
+// WrapHere wraps an existing error with an additional message and records the
+// location of its caller on the new layer, see WithCaller.
+// If err is nil, WrapHere returns nil.
+func WrapHere(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{
+		message: message,
+		cause:   err,
+		caller:  callerPC(0),
+	}
+}
+
+// WithCaller records the location of its caller on an error. Only a single
+// program counter is captured and it is resolved lazily when the error is
+// formatted or logged, which makes it much cheaper than WithStack.
+// If err is a standard error, it wraps it to record the location.
+func WithCaller(err error) error {
+	if err == nil {
+		return nil
+	}
+	z, ok := err.(*Error)
+	if !ok {
+		// Upgrade standard error to zerr.Error safely
+		z = &Error{cause: err}
+	}
+	newErr := z.clone()
+	newErr.caller = callerPC(0)
+	return newErr
+}
+
+// WithCode attaches a machine-readable code to an error.
+// If err is a standard error, it wraps it to attach the code.
+func WithCode(err error, code string) error {
 	if err == nil {
 		return nil
 	}
 	if z, ok := err.(*Error); ok {
-		return z.WithStack()
+		return z.WithCode(code)
 	}
 	// Upgrade standard error to zerr.Error safely
-	wrapped := Wrap(err, "")
-	if z, ok := wrapped.(*Error); ok {
-		return z.WithStack()
+	z := &Error{cause: err}
+	return z.WithCode(code)
+}
+
+// Code returns the outermost code in the error tree, including the errors
+// combined by Join in order, or "" if there is none.
+func Code(err error) string {
+	for e := range layers(err) {
+		if z, ok := e.(*Error); ok && z.extension().code != "" {
+			return z.extension().code
+		}
 	}
-	return wrapped
+	return ""
+}
+
+// clone returns a shallow copy of the error. The copy is made by value, which
+// keeps clone and its callers such as WithStack cheap enough to be inlined.
+func (e *Error) clone() *Error {
+	newErr := *e
+	return &newErr
 }
 
 // With attaches a key-value pair to the error as metadata.
 func (e *Error) With(key string, value any) *Error {
-	// Create a new error with the additional metadata
-	newErr := &Error{
-		message:  e.message,
-		cause:    e.cause,
-		stack:    e.stack,
-		metadata: make([]metaPair, len(e.metadata), len(e.metadata)+1),
+	newErr := e.with(key, value)
+	if newErr.caller == 0 && returnTraces.Load() {
+		newErr.caller = callerPC(0)
 	}
+	return newErr
+}
+
+// with returns a copy of the error with the additional metadata.
+func (e *Error) with(key string, value any) *Error {
+	// Create a new error with the additional metadata
+	newErr := e.clone()
+	newErr.metadata = make([]metaPair, len(e.metadata), len(e.metadata)+1)
 	copy(newErr.metadata, e.metadata)
 	newErr.metadata = append(newErr.metadata, metaPair{
 		key:   unique.Make(key),
@@ -120,17 +337,68 @@ func (e *Error) With(key string, value any) *Error {
 	return newErr
 }
 
+// withKeyvals attaches alternating key-value pairs to the error as metadata,
+// in the style of slog. Keys that are not strings and trailing keys without a
+// value are stored under "!BADKEY".
+func (e *Error) withKeyvals(keyvals []any) *Error {
+	if len(keyvals) == 0 {
+		return e
+	}
+
+	newErr := e.clone()
+	newErr.metadata = make([]metaPair, len(e.metadata), len(e.metadata)+(len(keyvals)+1)/2)
+	copy(newErr.metadata, e.metadata)
+
+	for len(keyvals) > 0 {
+		key, ok := keyvals[0].(string)
+		if !ok || len(keyvals) == 1 {
+			newErr.metadata = append(newErr.metadata, metaPair{
+				key:   unique.Make("!BADKEY"),
+				value: keyvals[0],
+			})
+			keyvals = keyvals[1:]
+			continue
+		}
+		newErr.metadata = append(newErr.metadata, metaPair{
+			key:   unique.Make(key),
+			value: keyvals[1],
+		})
+		keyvals = keyvals[2:]
+	}
+	return newErr
+}
+
 // WithStack captures a stack trace for this error.
 func (e *Error) WithStack() *Error {
-	entry := getOrCreateStack(2)
+	// Copy by value rather than through clone to stay within the inlining budget
+	newErr := *e
+	newErr.stack = getOrCreateStack(2)
+	return &newErr
+}
 
-	// Return a new error with the stack trace
-	return &Error{
-		message:  e.message,
-		cause:    e.cause,
-		stack:    entry,
-		metadata: e.metadata,
+// WithStackIfMissing captures a stack trace for this error unless its chain
+// already carries one, in which case the error is returned unchanged.
+func (e *Error) WithStackIfMissing() *Error {
+	if deepestStack(e) != nil {
+		return e
 	}
+	newErr := e.clone()
+	newErr.stack = getOrCreateStack(2)
+	return newErr
+}
+
+// WithCaller records the location of its caller on this error.
+func (e *Error) WithCaller() *Error {
+	newErr := e.clone()
+	newErr.caller = callerPC(0)
+	return newErr
+}
+
+// WithCode attaches a machine-readable code to the error.
+func (e *Error) WithCode(code string) *Error {
+	newErr := e.extend()
+	newErr.ext.code = code
+	return newErr
 }
 
 // Error implements the error interface.
@@ -155,11 +423,8 @@ func (e *Error) Format(s fmt.State, verb rune) {
 	switch verb {
 	case 'v':
 		if s.Flag('+') {
-			// Print with stack trace
-			fmt.Fprint(s, e.Error())
-			if e.stack != nil {
-				e.formatStack(s)
-			}
+			// Print with return trace and stack trace
+			writeVerbose(s, e, e.stack, int(sourceContext.Load()))
 			return
 		}
 		fallthrough
@@ -169,21 +434,3 @@ func (e *Error) Format(s fmt.State, verb rune) {
 		fmt.Fprintf(s, "%q", e.Error())
 	}
 }
-
-// formatStack formats the stack trace for printing.
-func (e *Error) formatStack(s fmt.State) {
-	if e.stack.formatted != "" {
-		fmt.Fprint(s, e.stack.formatted)
-		return
-	}
-
-	// Format the stack trace
-	frames := runtime.CallersFrames(e.stack.pc)
-	for {
-		frame, more := frames.Next()
-		fmt.Fprintf(s, "\n%s:%d %s", frame.File, frame.Line, frame.Function)
-		if !more {
-			break
-		}
-	}
-}
@@ -48,3 +48,60 @@ func BenchmarkErrorFormatting(b *testing.B) {
 		_ = err.Error()
 	}
 }
+
+func BenchmarkAnnotateNoError(b *testing.B) {
+	annotated := func(id int) (err error) {
+		defer Annotate(&err, "op", "CreateUser", "user_id", id)
+		return nil
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		_ = annotated(12345)
+	}
+}
+
+func BenchmarkAnnotateLazyNoError(b *testing.B) {
+	annotated := func(id int) (err error) {
+		defer AnnotateLazy(&err, func() []any { return []any{"op", "CreateUser", "user_id", id} })
+		return nil
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		_ = annotated(12345)
+	}
+}
+
+func BenchmarkWrapHere(b *testing.B) {
+	err := errors.New("base error")
+	b.ReportAllocs()
+	for b.Loop() {
+		_ = WrapHere(err, "wrapper")
+	}
+}
+
+// sink keeps benchmarked errors escaping, as errors returned to callers do.
+var sink error
+
+func BenchmarkNewEscaping(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		sink = New("test error")
+	}
+}
+
+func BenchmarkWrapEscaping(b *testing.B) {
+	err := errors.New("base error")
+	b.ReportAllocs()
+	for b.Loop() {
+		sink = Wrap(err, "wrapper")
+	}
+}
+
+func BenchmarkNewWithStackPolicy(b *testing.B) {
+	SetStackPolicy(StackPolicy{Capture: CaptureNew, First: 1, Every: 100})
+	defer SetStackPolicy(StackPolicy{})
+	b.ReportAllocs()
+	for b.Loop() {
+		_ = New("test error")
+	}
+}